@@ -0,0 +1,142 @@
+package api
+
+import (
+	"net/http"
+	"pickup/service"
+	"strconv"
+	"strings"
+
+	"github.com/Undercurrent-Technologies/kprime-utilities/types"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const activitiesPath = "/api/v1/activities"
+
+type ActivityHandler struct {
+	service service.ActivityService
+	chain   service.ChainService
+}
+
+func NewActivityHandler(s service.ActivityService, cs service.ChainService) *ActivityHandler {
+	return &ActivityHandler{service: s, chain: cs}
+}
+
+func (h *ActivityHandler) Register(mux *http.ServeMux) {
+	// Activities hold the orders and trades of every user
+	mux.Handle(activitiesPath, authenticate(http.HandlerFunc(h.List)))
+	mux.Handle(activitiesPath+"/", authenticate(http.HandlerFunc(h.Get)))
+}
+
+// List handles GET /api/v1/activities with optional topic, nonce, fromNonce,
+// toNonce, kafkaOffset, page and limit query parameters.
+func (h *ActivityHandler) List(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, http.MethodGet) {
+		return
+	}
+
+	f := service.ActivityFilter{Topic: r.URL.Query().Get("topic")}
+	if f.Topic != "" && f.Topic != types.ENGINE.String() && f.Topic != types.CANCELLED_ORDER.String() {
+		writeError(w, http.StatusBadRequest, "InvalidTopic")
+		return
+	}
+
+	var err error
+	params := map[string]**int64{
+		"nonce":       &f.Nonce,
+		"fromNonce":   &f.FromNonce,
+		"toNonce":     &f.ToNonce,
+		"kafkaOffset": &f.KafkaOffset,
+	}
+	for k, v := range params {
+		if *v, err = queryInt64(r, k); err != nil {
+			writeError(w, http.StatusBadRequest, "Invalid "+k)
+			return
+		}
+	}
+
+	f.Page, f.Limit = pagination(r)
+
+	acts, err := h.service.Find(f)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	// The service fetches one extra activity when another page exists
+	p := &Pagination{Page: f.Page, Limit: f.Limit}
+	if int64(len(acts)) > f.Limit {
+		p.HasMore = true
+		acts = acts[:f.Limit]
+	}
+
+	writeJSON(w, http.StatusOK, response{Data: acts, Pagination: p})
+}
+
+// Get handles GET /api/v1/activities/{id}, GET /api/v1/activities/nonce/{nonce}
+// and GET /api/v1/activities/verify.
+func (h *ActivityHandler) Get(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, http.MethodGet) {
+		return
+	}
+
+	path := strings.TrimPrefix(r.URL.Path, activitiesPath+"/")
+	if path == "verify" {
+		h.verify(w, r)
+		return
+	}
+
+	if v, ok := strings.CutPrefix(path, "nonce/"); ok {
+		nonce, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "InvalidNonce")
+			return
+		}
+
+		act := h.service.FindByNonce(nonce)
+		if act == nil {
+			writeError(w, http.StatusNotFound, "ActivityNotFound")
+			return
+		}
+
+		writeData(w, act)
+		return
+	}
+
+	id, err := primitive.ObjectIDFromHex(path)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "InvalidID")
+		return
+	}
+
+	act := h.service.FindByID(id)
+	if act == nil {
+		writeError(w, http.StatusNotFound, "ActivityNotFound")
+		return
+	}
+
+	writeData(w, act)
+}
+
+// verify walks the activity hash chain with optional fromNonce and toNonce
+// query parameters.
+func (h *ActivityHandler) verify(w http.ResponseWriter, r *http.Request) {
+	from, err := queryInt64(r, "fromNonce")
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid fromNonce")
+		return
+	}
+
+	to, err := queryInt64(r, "toNonce")
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid toNonce")
+		return
+	}
+
+	report, err := h.chain.Verify(from, to)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	writeData(w, report)
+}
@@ -0,0 +1,386 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"pickup/datasources/kafka"
+	"pickup/service"
+	"strings"
+	"time"
+
+	"github.com/Undercurrent-Technologies/kprime-utilities/types"
+)
+
+const adminPath = "/api/v1/admin/"
+
+type AdminHandler struct {
+	service service.AdminService
+}
+
+type seekRequest struct {
+	Partition int    `json:"partition"`
+	Offset    *int64 `json:"offset"`
+	Nonce     *int64 `json:"nonce"`
+}
+
+// seekWarning reminds that seeking commits the offset for the whole consumer
+// group through a temporary member.
+const seekWarning = "The offset is committed for the whole consumer group, the other replicas must be paused while seeking"
+
+type seekResponse struct {
+	Status  string `json:"status"`
+	Warning string `json:"warning"`
+}
+
+type restoreRequest struct {
+	FromNonce int64 `json:"fromNonce"`
+	ToNonce   int64 `json:"toNonce"`
+}
+
+type overrideRequest struct {
+	Reason   string `json:"reason"`
+	Duration string `json:"duration"`
+}
+
+func NewAdminHandler(s service.AdminService) *AdminHandler {
+	return &AdminHandler{service: s}
+}
+
+func (h *AdminHandler) Register(mux *http.ServeMux) {
+	mux.Handle(adminPath, authenticate(http.HandlerFunc(h.Handle)))
+}
+
+// actor returns the operator of the request. The "X-Actor" name is declared
+// by the caller, the admin API key being shared, so the fingerprint of the key
+// and the remote address are recorded with it.
+func actor(r *http.Request) service.Actor {
+	a := service.Actor{Name: "admin", KeyFingerprint: fingerprint(adminToken(r)), RemoteAddr: r.RemoteAddr}
+	if name := r.Header.Get("X-Actor"); name != "" {
+		a.Name = name
+	}
+
+	if f := r.Header.Get("X-Forwarded-For"); f != "" {
+		a.RemoteAddr = f + " via " + r.RemoteAddr
+	}
+
+	return a
+}
+
+// Handle handles
+//   - GET /api/v1/admin/consumers
+//   - POST /api/v1/admin/consumers/{topic}/pause
+//   - POST /api/v1/admin/consumers/{topic}/resume
+//   - POST /api/v1/admin/consumers/{topic}/seek
+//   - POST /api/v1/admin/jobs/nonce-monitoring
+//   - POST /api/v1/admin/jobs/settlement
+//   - GET /api/v1/admin/engine
+//   - POST /api/v1/admin/engine/halt
+//   - POST /api/v1/admin/engine/resume
+//   - DELETE /api/v1/admin/engine/override
+//   - GET /api/v1/admin/engine/history
+//   - POST /api/v1/admin/activities/archive
+//   - POST /api/v1/admin/activities/restore
+//   - GET /api/v1/admin/audits
+//   - GET /api/v1/admin/fees
+//   - GET /api/v1/admin/fees/report
+//   - GET /api/v1/admin/fees/check
+func (h *AdminHandler) Handle(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, adminPath), "/")
+
+	switch {
+	case len(parts) == 1 && parts[0] == "consumers":
+		if allowMethod(w, r, http.MethodGet) {
+			writeData(w, h.service.Consumers())
+		}
+	case len(parts) == 3 && parts[0] == "consumers":
+		if allowMethod(w, r, http.MethodPost) {
+			h.consumer(w, r, parts[1], parts[2])
+		}
+	case len(parts) == 2 && parts[0] == "jobs" && parts[1] == "nonce-monitoring":
+		if allowMethod(w, r, http.MethodPost) {
+			h.service.RunNonceMonitoring(actor(r))
+			writeData(w, "OK")
+		}
+	case len(parts) == 2 && parts[0] == "jobs" && parts[1] == "settlement":
+		if allowMethod(w, r, http.MethodPost) {
+			h.settlement(w, r)
+		}
+	case len(parts) == 1 && parts[0] == "engine":
+		if allowMethod(w, r, http.MethodGet) {
+			h.engine(w)
+		}
+	case len(parts) == 2 && parts[0] == "engine" && parts[1] == "halt":
+		if allowMethod(w, r, http.MethodPost) {
+			h.overrideEngine(w, r, types.OFF.String())
+		}
+	case len(parts) == 2 && parts[0] == "engine" && parts[1] == "resume":
+		if allowMethod(w, r, http.MethodPost) {
+			h.overrideEngine(w, r, types.ON.String())
+		}
+	case len(parts) == 2 && parts[0] == "engine" && parts[1] == "override":
+		if allowMethod(w, r, http.MethodDelete) {
+			if err := h.service.ClearEngineOverride(actor(r)); err != nil {
+				writeServiceError(w, err)
+				return
+			}
+			writeData(w, "OK")
+		}
+	case len(parts) == 2 && parts[0] == "engine" && parts[1] == "history":
+		if allowMethod(w, r, http.MethodGet) {
+			h.engineHistory(w, r)
+		}
+	case len(parts) == 2 && parts[0] == "activities" && parts[1] == "archive":
+		if allowMethod(w, r, http.MethodPost) {
+			h.archive(w, r)
+		}
+	case len(parts) == 2 && parts[0] == "activities" && parts[1] == "restore":
+		if allowMethod(w, r, http.MethodPost) {
+			h.restore(w, r)
+		}
+	case len(parts) == 1 && parts[0] == "audits":
+		if allowMethod(w, r, http.MethodGet) {
+			h.audits(w, r)
+		}
+	case len(parts) == 1 && parts[0] == "fees":
+		if allowMethod(w, r, http.MethodGet) {
+			h.feeAccounts(w)
+		}
+	case len(parts) == 2 && parts[0] == "fees" && parts[1] == "report":
+		if allowMethod(w, r, http.MethodGet) {
+			h.feeReport(w, r)
+		}
+	case len(parts) == 2 && parts[0] == "fees" && parts[1] == "check":
+		if allowMethod(w, r, http.MethodGet) {
+			h.checkFees(w, r)
+		}
+	default:
+		writeError(w, http.StatusNotFound, "NotFound")
+	}
+}
+
+func (h *AdminHandler) consumer(w http.ResponseWriter, r *http.Request, topic, action string) {
+	var err error
+
+	switch action {
+	case "pause":
+		err = h.service.Pause(actor(r), topic)
+	case "resume":
+		err = h.service.Resume(actor(r), topic)
+	case "seek":
+		req := seekRequest{}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, "InvalidBody")
+			return
+		}
+
+		if (req.Offset == nil) == (req.Nonce == nil) {
+			writeError(w, http.StatusBadRequest, "EitherOffsetOrNonceRequired")
+			return
+		}
+
+		if req.Offset != nil {
+			err = h.service.Seek(actor(r), topic, req.Partition, *req.Offset)
+		} else {
+			err = h.service.SeekNonce(actor(r), topic, req.Partition, *req.Nonce)
+		}
+	default:
+		writeError(w, http.StatusNotFound, "NotFound")
+		return
+	}
+
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+
+	if action == "seek" {
+		writeData(w, seekResponse{Status: "OK", Warning: seekWarning})
+		return
+	}
+
+	writeData(w, "OK")
+}
+
+func (h *AdminHandler) engine(w http.ResponseWriter) {
+	e, err := h.service.Engine()
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+
+	writeData(w, e)
+}
+
+func (h *AdminHandler) overrideEngine(w http.ResponseWriter, r *http.Request, status string) {
+	req := overrideRequest{}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "InvalidBody")
+		return
+	}
+
+	if req.Reason == "" {
+		writeError(w, http.StatusBadRequest, "ReasonRequired")
+		return
+	}
+
+	var ttl time.Duration
+	if req.Duration != "" {
+		d, err := time.ParseDuration(req.Duration)
+		if err != nil || d <= 0 {
+			writeError(w, http.StatusBadRequest, "InvalidDuration")
+			return
+		}
+		ttl = d
+	}
+
+	if err := h.service.OverrideEngine(actor(r), status, req.Reason, ttl); err != nil {
+		writeServiceError(w, err)
+		return
+	}
+
+	writeData(w, "OK")
+}
+
+func (h *AdminHandler) engineHistory(w http.ResponseWriter, r *http.Request) {
+	page, limit := pagination(r)
+
+	history, err := h.service.FindEngineHistory(page, limit)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusOK, response{Data: history, Pagination: &Pagination{Page: page, Limit: limit}})
+}
+
+func (h *AdminHandler) settlement(w http.ResponseWriter, r *http.Request) {
+	total, err := h.service.RunSettlement(actor(r))
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	writeData(w, map[string]int{"total": total})
+}
+
+func (h *AdminHandler) archive(w http.ResponseWriter, r *http.Request) {
+	total, err := h.service.ArchiveActivities(actor(r))
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	writeData(w, map[string]int{"total": total})
+}
+
+func (h *AdminHandler) restore(w http.ResponseWriter, r *http.Request) {
+	req := restoreRequest{}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "InvalidBody")
+		return
+	}
+
+	if req.FromNonce > req.ToNonce {
+		writeError(w, http.StatusBadRequest, "InvalidNonceRange")
+		return
+	}
+
+	total, err := h.service.RestoreActivities(actor(r), req.FromNonce, req.ToNonce)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	writeData(w, map[string]int{"total": total})
+}
+
+func (h *AdminHandler) audits(w http.ResponseWriter, r *http.Request) {
+	page, limit := pagination(r)
+
+	audits, err := h.service.FindAudits(page, limit)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusOK, response{Data: audits, Pagination: &Pagination{Page: page, Limit: limit}})
+}
+
+func (h *AdminHandler) feeAccounts(w http.ResponseWriter) {
+	accounts, err := h.service.FindFeeAccounts()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	writeData(w, accounts)
+}
+
+func (h *AdminHandler) feeReport(w http.ResponseWriter, r *http.Request) {
+	from, to, ok := timeRange(w, r)
+	if !ok {
+		return
+	}
+
+	group := r.URL.Query().Get("groupBy")
+	if group == "" {
+		group = "day"
+	}
+
+	report, err := h.service.FeeReport(group, from, to)
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidGroup) {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	writeData(w, report)
+}
+
+func (h *AdminHandler) checkFees(w http.ResponseWriter, r *http.Request) {
+	from, to, ok := timeRange(w, r)
+	if !ok {
+		return
+	}
+
+	res, err := h.service.CheckFees(from, to)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	writeData(w, res)
+}
+
+// timeRange reads the from and to query parameters.
+func timeRange(w http.ResponseWriter, r *http.Request) (from, to *time.Time, ok bool) {
+	from, err := queryTime(r, "from")
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "InvalidFrom")
+		return nil, nil, false
+	}
+
+	to, err = queryTime(r, "to")
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "InvalidTo")
+		return nil, nil, false
+	}
+
+	return from, to, true
+}
+
+func writeServiceError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, kafka.ErrTopicNotFound), errors.Is(err, service.ErrActivityNotFound):
+		writeError(w, http.StatusNotFound, err.Error())
+	case errors.Is(err, service.ErrOverrideExpiryDisabled):
+		writeError(w, http.StatusBadRequest, err.Error())
+	default:
+		writeError(w, http.StatusInternalServerError, err.Error())
+	}
+}
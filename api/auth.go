@@ -0,0 +1,93 @@
+package api
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"net/http"
+	"pickup/app"
+	"strings"
+
+	"github.com/gorilla/websocket"
+)
+
+// authenticate only lets through requests carrying the configured admin API
+// key, either as "X-API-Key" or as a bearer token.
+func authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if app.Config.Admin.APIKey == "" {
+			writeError(w, http.StatusServiceUnavailable, "AdminAPIDisabled")
+			return
+		}
+
+		if !isAdmin(r) {
+			writeError(w, http.StatusUnauthorized, "Unauthorized")
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+func isAdmin(r *http.Request) bool {
+	key := app.Config.Admin.APIKey
+	if key == "" {
+		return false
+	}
+
+	return subtle.ConstantTimeCompare([]byte(adminToken(r)), []byte(key)) == 1
+}
+
+func adminToken(r *http.Request) string {
+	if token := r.Header.Get("X-API-Key"); token != "" {
+		return token
+	}
+
+	return strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+}
+
+// fingerprint identifies a key without revealing it.
+func fingerprint(key string) string {
+	if key == "" {
+		return ""
+	}
+
+	sum := sha256.Sum256([]byte(key))
+
+	return hex.EncodeToString(sum[:6])
+}
+
+// isUser tells whether the request is made by the admin or carries the user
+// token, i.e. the hex HMAC-SHA256 of the user ID keyed by the configured user
+// token secret, issued by the gateway.
+func isUser(r *http.Request, userID string) bool {
+	if isAdmin(r) {
+		return true
+	}
+
+	secret := app.Config.Admin.UserTokenSecret
+	token := userToken(r)
+	if secret == "" || token == "" {
+		return false
+	}
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(userID))
+
+	return subtle.ConstantTimeCompare([]byte(token), []byte(hex.EncodeToString(mac.Sum(nil)))) == 1
+}
+
+// userToken returns the "X-User-Token" header, websocket requests from
+// browsers, which cannot set it, carry the token as query parameter instead.
+func userToken(r *http.Request) string {
+	if token := r.Header.Get("X-User-Token"); token != "" {
+		return token
+	}
+
+	if websocket.IsWebSocketUpgrade(r) {
+		return r.URL.Query().Get("token")
+	}
+
+	return ""
+}
@@ -0,0 +1,107 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Undercurrent-Technologies/kprime-utilities/commons/log"
+)
+
+var logger = log.Logger
+
+const (
+	defaultLimit = 20
+	maxLimit     = 100
+)
+
+type Pagination struct {
+	Page    int64 `json:"page"`
+	Limit   int64 `json:"limit"`
+	HasMore bool  `json:"hasMore"`
+}
+
+type response struct {
+	Data       interface{} `json:"data,omitempty"`
+	Pagination *Pagination `json:"pagination,omitempty"`
+	Error      string      `json:"error,omitempty"`
+}
+
+func writeJSON(w http.ResponseWriter, status int, res response) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+
+	if err := json.NewEncoder(w).Encode(res); err != nil {
+		logger.Errorf("Failed to encode response: %v", err)
+	}
+}
+
+func writeData(w http.ResponseWriter, data interface{}) {
+	writeJSON(w, http.StatusOK, response{Data: data})
+}
+
+func writeError(w http.ResponseWriter, status int, msg string) {
+	writeJSON(w, status, response{Error: msg})
+}
+
+func allowMethod(w http.ResponseWriter, r *http.Request, method string) bool {
+	if r.Method != method {
+		writeError(w, http.StatusMethodNotAllowed, "MethodNotAllowed")
+		return false
+	}
+
+	return true
+}
+
+// queryInt64 parses an optional integer query parameter, returning nil when absent.
+func queryInt64(r *http.Request, key string) (*int64, error) {
+	v := r.URL.Query().Get(key)
+	if v == "" {
+		return nil, nil
+	}
+
+	n, err := strconv.ParseInt(v, 10, 64)
+	if err != nil {
+		return nil, err
+	}
+
+	return &n, nil
+}
+
+// pagination reads page and limit query parameters, falling back to defaults.
+func pagination(r *http.Request) (page, limit int64) {
+	page, limit = 1, defaultLimit
+
+	if p, err := queryInt64(r, "page"); err == nil && p != nil && *p > 0 {
+		page = *p
+	}
+
+	if l, err := queryInt64(r, "limit"); err == nil && l != nil && *l > 0 {
+		limit = *l
+	}
+
+	if limit > maxLimit {
+		limit = maxLimit
+	}
+
+	return page, limit
+}
+
+// queryTime reads an RFC3339 time or a YYYY-MM-DD date query parameter, nil
+// when absent.
+func queryTime(r *http.Request, key string) (*time.Time, error) {
+	v := r.URL.Query().Get(key)
+	if v == "" {
+		return nil, nil
+	}
+
+	t, err := time.Parse(time.RFC3339, v)
+	if err != nil {
+		if t, err = time.Parse("2006-01-02", v); err != nil {
+			return nil, err
+		}
+	}
+
+	return &t, nil
+}
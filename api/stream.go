@@ -0,0 +1,207 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"pickup/app"
+	"pickup/models/stream"
+	"pickup/service"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const streamPath = "/api/v1/stream"
+
+var errStreamClosed = errors.New("StreamClosed")
+
+var upgrader = websocket.Upgrader{CheckOrigin: allowedOrigin}
+
+// allowedOrigin lets through clients sending no origin, i.e. not browsers,
+// and browsers on the configured origins, "*" allowing any origin.
+func allowedOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+
+	for _, o := range strings.Split(app.Config.Stream.AllowedOrigins, ",") {
+		if o = strings.TrimSpace(o); o == "*" || strings.EqualFold(o, origin) {
+			return true
+		}
+	}
+
+	return false
+}
+
+type StreamHandler struct {
+	service      *service.StreamService
+	pingInterval time.Duration
+	writeTimeout time.Duration
+}
+
+func NewStreamHandler(s *service.StreamService) *StreamHandler {
+	return &StreamHandler{
+		service:      s,
+		pingInterval: milliseconds(app.Config.Stream.PingInterval, 30000),
+		writeTimeout: milliseconds(app.Config.Stream.WriteTimeout, 5000),
+	}
+}
+
+func (h *StreamHandler) Register(mux *http.ServeMux) {
+	mux.HandleFunc(streamPath, h.Stream)
+}
+
+// Stream handles GET /api/v1/stream?userId=&instrument=&topic=&fromNonce=&token=
+//
+// The archived and saved activities from fromNonce are replayed before the
+// live events. Clients which do not keep up are closed with "SlowConsumer"
+// and resume from the last received nonce. Only the admin streams every
+// user and the activities as saved, other clients stream the orders and trade
+// sides of the user of their token. Browsers, which cannot set headers on
+// websockets, pass the user token as the "token" query parameter.
+func (h *StreamHandler) Stream(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, http.MethodGet) {
+		return
+	}
+
+	q := r.URL.Query()
+	f := service.StreamFilter{UserID: q.Get("userId"), InstrumentName: q.Get("instrument"), Topic: q.Get("topic"), Admin: isAdmin(r)}
+	if f.UserID != "" && !primitive.IsValidObjectID(f.UserID) {
+		writeError(w, http.StatusBadRequest, "InvalidUserID")
+		return
+	}
+
+	if !f.Admin && (f.UserID == "" || !isUser(r, f.UserID)) {
+		writeError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	from, err := queryInt64(r, "fromNonce")
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "InvalidFromNonce")
+		return
+	}
+
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// The upgrader already replied with an error
+		return
+	}
+	defer conn.Close()
+
+	// Subscribe before replaying, so that no event is missed in between, the
+	// live events are kept aside during the replay
+	sub := h.service.Subscribe(f, from != nil)
+	defer h.service.Unsubscribe(sub)
+
+	closed := h.read(conn)
+	ping := time.NewTicker(h.pingInterval)
+	defer ping.Stop()
+
+	last := int64(0)
+	send := func(e *stream.Event) error {
+		// Skip the events which were already replayed
+		if e.Nonce != 0 && e.Nonce <= last {
+			return nil
+		}
+
+		conn.SetWriteDeadline(time.Now().Add(h.writeTimeout))
+		return conn.WriteJSON(e)
+	}
+
+	if from != nil {
+		// Keep pinging while replaying, the client is timed out otherwise
+		replay := func(e *stream.Event) error {
+			select {
+			case <-closed:
+				return errStreamClosed
+			case <-ping.C:
+				if err := h.ping(conn); err != nil {
+					return err
+				}
+			default:
+			}
+
+			conn.SetWriteDeadline(time.Now().Add(h.writeTimeout))
+			return conn.WriteJSON(e)
+		}
+
+		if last, err = h.service.Replay(f, *from, replay); err != nil {
+			if !errors.Is(err, errStreamClosed) {
+				logger.Errorf("Failed to replay stream: %v", err)
+				h.close(conn, websocket.CloseInternalServerErr, "ReplayFailed")
+			}
+			return
+		}
+
+		for _, e := range sub.Live() {
+			if err := send(e); err != nil {
+				return
+			}
+		}
+	}
+
+	for {
+		select {
+		case e := <-sub.Events:
+			if err := send(e); err != nil {
+				return
+			}
+		case <-sub.Done:
+			h.close(conn, websocket.CloseTryAgainLater, "SlowConsumer")
+			return
+		case <-ping.C:
+			if err := h.ping(conn); err != nil {
+				return
+			}
+		case <-closed:
+			return
+		}
+	}
+}
+
+// read discards the client messages, handles the pongs and returns a channel
+// closed once the client is gone.
+func (h *StreamHandler) read(conn *websocket.Conn) <-chan struct{} {
+	closed := make(chan struct{})
+	timeout := 2 * h.pingInterval
+
+	conn.SetReadLimit(512)
+	conn.SetReadDeadline(time.Now().Add(timeout))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(timeout))
+	})
+
+	go func() {
+		defer close(closed)
+		for {
+			if _, _, err := conn.NextReader(); err != nil {
+				return
+			}
+		}
+	}()
+
+	return closed
+}
+
+func (h *StreamHandler) ping(conn *websocket.Conn) error {
+	return conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(h.writeTimeout))
+}
+
+func (h *StreamHandler) close(conn *websocket.Conn, code int, reason string) {
+	msg := websocket.FormatCloseMessage(code, reason)
+	conn.WriteControl(websocket.CloseMessage, msg, time.Now().Add(h.writeTimeout))
+}
+
+func milliseconds(v string, def int) time.Duration {
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		n = def
+	}
+
+	return time.Duration(n) * time.Millisecond
+}
@@ -0,0 +1,130 @@
+package api
+
+import (
+	"net/http"
+	"pickup/service"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const usersPath = "/api/v1/users/"
+
+type UserHandler struct {
+	service service.UserService
+}
+
+func NewUserHandler(s service.UserService) *UserHandler {
+	return &UserHandler{service: s}
+}
+
+func (h *UserHandler) Register(mux *http.ServeMux) {
+	mux.HandleFunc(usersPath, h.Get)
+}
+
+// Get handles
+//   - GET /api/v1/users/{id}/collaterals
+//   - GET /api/v1/users/{id}/balances
+//   - GET /api/v1/users/{id}/positions
+//   - GET /api/v1/users/{id}/positions/{instrument}/trades?page=&limit=
+//   - GET /api/v1/users/{id}/settlements
+func (h *UserHandler) Get(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, http.MethodGet) {
+		return
+	}
+
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, usersPath), "/")
+	if len(parts) < 2 {
+		writeError(w, http.StatusNotFound, "NotFound")
+		return
+	}
+
+	id, err := primitive.ObjectIDFromHex(parts[0])
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "InvalidUserID")
+		return
+	}
+
+	if !isUser(r, id.Hex()) {
+		writeError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	switch {
+	case len(parts) == 2 && parts[1] == "collaterals":
+		h.collaterals(w, id)
+	case len(parts) == 2 && parts[1] == "balances":
+		h.balances(w, id)
+	case len(parts) == 2 && parts[1] == "positions":
+		h.positions(w, id)
+	case len(parts) == 4 && parts[1] == "positions" && parts[3] == "trades":
+		h.positionTrades(w, r, id, parts[2])
+	case len(parts) == 2 && parts[1] == "settlements":
+		h.settlements(w, id)
+	default:
+		writeError(w, http.StatusNotFound, "NotFound")
+	}
+}
+
+func (h *UserHandler) collaterals(w http.ResponseWriter, id primitive.ObjectID) {
+	c := h.service.FindCollaterals(id)
+	if c == nil {
+		writeError(w, http.StatusNotFound, "UserNotFound")
+		return
+	}
+
+	writeData(w, c)
+}
+
+func (h *UserHandler) balances(w http.ResponseWriter, id primitive.ObjectID) {
+	b := h.service.FindBalances(id)
+	if b == nil {
+		writeError(w, http.StatusNotFound, "UserNotFound")
+		return
+	}
+
+	writeData(w, b)
+}
+
+func (h *UserHandler) positions(w http.ResponseWriter, id primitive.ObjectID) {
+	p, err := h.service.FindPositions(id)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if p == nil {
+		writeError(w, http.StatusNotFound, "UserNotFound")
+		return
+	}
+
+	writeData(w, p)
+}
+
+func (h *UserHandler) positionTrades(w http.ResponseWriter, r *http.Request, id primitive.ObjectID, instrument string) {
+	page, limit := pagination(r)
+	t, err := h.service.FindPositionTrades(id, instrument, page, limit)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	// The service fetches one extra trade when another page exists
+	p := &Pagination{Page: page, Limit: limit}
+	if int64(len(t)) > limit {
+		p.HasMore = true
+		t = t[:limit]
+	}
+
+	writeJSON(w, http.StatusOK, response{Data: t, Pagination: p})
+}
+
+func (h *UserHandler) settlements(w http.ResponseWriter, id primitive.ObjectID) {
+	s, err := h.service.FindSettlements(id)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	writeData(w, s)
+}
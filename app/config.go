@@ -18,8 +18,22 @@ type AppConfig struct {
 	Mongo             `yaml:"mongo"`
 	Kafka             `yaml:"kafka"`
 	Scheduler         `yaml:"scheduler"`
+	Admin             `yaml:"admin"`
+	Gateway           `yaml:"gateway"`
+	Engine            `yaml:"engine"`
+	Nonce             `yaml:"nonce"`
+	Webhook           `yaml:"webhook"`
+	Resync            `yaml:"resync"`
+	Archive           `yaml:"archive"`
+	Recovery          `yaml:"recovery"`
+	Collateral        `yaml:"collateral"`
+	Reservation       `yaml:"reservation"`
+	Settlement        `yaml:"settlement"`
+	Instrument        `yaml:"instrument"`
+	Stream            `yaml:"stream"`
 	NonceDiff         string `yaml:"nonce_diff" env:"NONCE_DIFF" env-default:"20"`
 	MatchingEngineURL string `yaml:"matching_engine_url" env:"MATCHING_ENGINE_URL" env-default:"http://localhost:8080"`
+	GatewayURL        string `yaml:"gateway_url" env:"GATEWAY_URL" env-default:"http://localhost:8082"`
 }
 
 type HTTP struct {
@@ -33,12 +47,97 @@ type Kafka struct {
 }
 
 type Mongo struct {
-	Database string `yaml:"mongo_database" env:"MONGO_DATABASE" env-default:"option_exchange"`
-	URL      string `yaml:"mongo_url" env:"MONGO_URL" env-default:"mongodb://localhost:27017"`
+	Database         string `yaml:"mongo_database" env:"MONGO_DATABASE" env-default:"option_exchange"`
+	URL              string `yaml:"mongo_url" env:"MONGO_URL" env-default:"mongodb://localhost:27017"`
+	MigrateOnStartup string `yaml:"mongo_migrate_on_startup" env:"MONGO_MIGRATE_ON_STARTUP" env-default:"true"`
 }
 
 type Scheduler struct {
 	MonitoringInterval string `yaml:"monitoring_interval" env:"MONITORING_INTERVAL" env-default:"1000"`
+	NonceMonitoring    string `yaml:"nonce_monitoring" env:"NONCE_MONITORING" env-default:"false"`
+	GatewayMonitoring  string `yaml:"gateway_monitoring" env:"GATEWAY_MONITORING" env-default:"false"`
+	CheckpointInterval string `yaml:"checkpoint_interval" env:"CHECKPOINT_INTERVAL" env-default:"60000"`
+	ArchiveInterval    string `yaml:"archive_interval" env:"ARCHIVE_INTERVAL" env-default:"3600000"`
+	SettlementInterval string `yaml:"settlement_interval" env:"SETTLEMENT_INTERVAL" env-default:"60000"`
+}
+
+type Nonce struct {
+	HaltSamples      string `yaml:"nonce_halt_samples" env:"NONCE_HALT_SAMPLES" env-default:"3"`
+	ResumeDiff       string `yaml:"nonce_resume_diff" env:"NONCE_RESUME_DIFF" env-default:"0"`
+	ResumeSamples    string `yaml:"nonce_resume_samples" env:"NONCE_RESUME_SAMPLES" env-default:"3"`
+	MinStateDuration string `yaml:"nonce_min_state_duration" env:"NONCE_MIN_STATE_DURATION" env-default:"10000"`
+}
+
+type Engine struct {
+	Timeout          string `yaml:"engine_timeout" env:"ENGINE_TIMEOUT" env-default:"2000"`
+	Retries          string `yaml:"engine_retries" env:"ENGINE_RETRIES" env-default:"2"`
+	Backoff          string `yaml:"engine_backoff" env:"ENGINE_BACKOFF" env-default:"200"`
+	BreakerThreshold string `yaml:"engine_breaker_threshold" env:"ENGINE_BREAKER_THRESHOLD" env-default:"5"`
+	BreakerCooldown  string `yaml:"engine_breaker_cooldown" env:"ENGINE_BREAKER_COOLDOWN" env-default:"10000"`
+}
+
+type Gateway struct {
+	HealthPath       string `yaml:"gateway_health_path" env:"GATEWAY_HEALTH_PATH" env-default:"/health"`
+	FailureThreshold string `yaml:"gateway_failure_threshold" env:"GATEWAY_FAILURE_THRESHOLD" env-default:"3"`
+	SuccessThreshold string `yaml:"gateway_success_threshold" env:"GATEWAY_SUCCESS_THRESHOLD" env-default:"3"`
+	OffOnNonceDiff   string `yaml:"gateway_off_on_nonce_diff" env:"GATEWAY_OFF_ON_NONCE_DIFF" env-default:"false"`
+}
+
+type Recovery struct {
+	Mode string `yaml:"recovery_mode" env:"RECOVERY_MODE" env-default:"warn"`
+}
+
+type Collateral struct {
+	Retries string `yaml:"collateral_retries" env:"COLLATERAL_RETRIES" env-default:"5"`
+}
+
+type Reservation struct {
+	FeeRate string `yaml:"reservation_fee_rate" env:"RESERVATION_FEE_RATE" env-default:"0"`
+}
+
+type Instrument struct {
+	Registry        string `yaml:"instrument_registry" env:"INSTRUMENT_REGISTRY"`
+	Names           string `yaml:"instruments" env:"INSTRUMENTS"`
+	RefreshInterval string `yaml:"instrument_refresh_interval" env:"INSTRUMENT_REFRESH_INTERVAL" env-default:"60000"`
+	ExpiryHour      string `yaml:"instrument_expiry_hour" env:"INSTRUMENT_EXPIRY_HOUR" env-default:"8"`
+	AlertInterval   string `yaml:"instrument_alert_interval" env:"INSTRUMENT_ALERT_INTERVAL" env-default:"3600000"`
+}
+
+type Stream struct {
+	Buffer         string `yaml:"stream_buffer" env:"STREAM_BUFFER" env-default:"256"`
+	PingInterval   string `yaml:"stream_ping_interval" env:"STREAM_PING_INTERVAL" env-default:"30000"`
+	WriteTimeout   string `yaml:"stream_write_timeout" env:"STREAM_WRITE_TIMEOUT" env-default:"5000"`
+	ReplayBuffer   string `yaml:"stream_replay_buffer" env:"STREAM_REPLAY_BUFFER" env-default:"10000"`
+	AllowedOrigins string `yaml:"stream_allowed_origins" env:"STREAM_ALLOWED_ORIGINS"`
+}
+
+type Settlement struct {
+	PriceURL  string `yaml:"settlement_price_url" env:"SETTLEMENT_PRICE_URL" env-default:"http://localhost:8083"`
+	PriceFile string `yaml:"settlement_price_file" env:"SETTLEMENT_PRICE_FILE"`
+	Timeout   string `yaml:"settlement_timeout" env:"SETTLEMENT_TIMEOUT" env-default:"2000"`
+}
+
+type Archive struct {
+	Mode      string `yaml:"archive_mode" env:"ARCHIVE_MODE" env-default:"file"`
+	Dir       string `yaml:"archive_dir" env:"ARCHIVE_DIR" env-default:"./archive"`
+	AfterDays string `yaml:"archive_after_days" env:"ARCHIVE_AFTER_DAYS" env-default:"30"`
+	BatchSize string `yaml:"archive_batch_size" env:"ARCHIVE_BATCH_SIZE" env-default:"1000"`
+}
+
+type Resync struct {
+	Enabled   string `yaml:"resync_enabled" env:"RESYNC_ENABLED" env-default:"false"`
+	BatchSize string `yaml:"resync_batch_size" env:"RESYNC_BATCH_SIZE" env-default:"500"`
+	StubFile  string `yaml:"resync_stub_file" env:"RESYNC_STUB_FILE"`
+}
+
+type Webhook struct {
+	URLs    string `yaml:"status_webhook_urls" env:"STATUS_WEBHOOK_URLS"`
+	Retries string `yaml:"status_webhook_retries" env:"STATUS_WEBHOOK_RETRIES" env-default:"3"`
+}
+
+type Admin struct {
+	APIKey          string `yaml:"admin_api_key" env:"ADMIN_API_KEY"`
+	UserTokenSecret string `yaml:"user_token_secret" env:"USER_TOKEN_SECRET"`
 }
 
 // LoadConfig loads configuration from the given list of paths and populates it into the Config variable.
@@ -30,6 +30,41 @@ var (
 		Name: "request_duration",
 		Help: "The total number of request duration",
 	}, labels)
+
+	EngineStatusGauge = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "engine_status",
+		Help: "The current matching engine status, 1 is ON and 0 is OFF",
+	})
+
+	GatewayStatusGauge = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "gateway_status",
+		Help: "The current gateway status, 1 is ON and 0 is OFF",
+	})
+
+	EngineOverrideGauge = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "engine_override",
+		Help: "The active operator override of the matching engine status",
+	}, []string{"status"})
+
+	CollateralConflictCounter = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "collateral_conflict_counter",
+		Help: "The total number of conflicting collateral updates, retried or exhausted",
+	}, []string{"result"})
+
+	RejectedInstrumentCounter = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "rejected_instrument_counter",
+		Help: "The total number of trades rejected for an invalid, unknown or expired instrument",
+	}, []string{"reason"})
+
+	IllegalTransitionCounter = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "illegal_transition_counter",
+		Help: "The total number of rejected order and trade status transitions",
+	}, []string{"entity", "from", "to"})
+
+	CancelDiscrepancyCounter = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "cancel_discrepancy_counter",
+		Help: "The total number of orders missing from or unexpected in mass-cancels",
+	}, []string{"type"})
 )
 
 type RequestDuration struct {
@@ -0,0 +1,64 @@
+package engine
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// Activity is a message processed by the matching engine, Payload is the
+// original kafka message value of the Topic.
+type Activity struct {
+	Nonce   int64           `json:"nonce"`
+	Topic   string          `json:"topic"`
+	Payload json.RawMessage `json:"payload"`
+}
+
+// ActivitiesResponse is the response of the engine activities endpoint.
+type ActivitiesResponse struct {
+	Data []Activity `json:"data"`
+}
+
+// FetchActivities returns the engine activities with nonce between from and
+// to inclusive, sorted by nonce.
+func (c *Client) FetchActivities(ctx context.Context, from, to int64) ([]Activity, error) {
+	res := ActivitiesResponse{}
+	path := fmt.Sprintf("/api/v1/activities?fromNonce=%d&toNonce=%d", from, to)
+	if err := c.get(ctx, path, &res); err != nil {
+		return nil, err
+	}
+
+	return res.Data, nil
+}
+
+// FileSource serves activities from a JSON file in the format of the engine
+// activities endpoint, to resync locally without a matching engine.
+type FileSource struct {
+	path string
+}
+
+func NewFileSource(path string) *FileSource {
+	return &FileSource{path: path}
+}
+
+func (f *FileSource) FetchActivities(ctx context.Context, from, to int64) ([]Activity, error) {
+	data, err := os.ReadFile(f.path)
+	if err != nil {
+		return nil, err
+	}
+
+	res := ActivitiesResponse{}
+	if err := json.Unmarshal(data, &res); err != nil {
+		return nil, err
+	}
+
+	acts := []Activity{}
+	for _, a := range res.Data {
+		if a.Nonce >= from && a.Nonce <= to {
+			acts = append(acts, a)
+		}
+	}
+
+	return acts, nil
+}
@@ -0,0 +1,61 @@
+package engine
+
+import (
+	"sync"
+	"time"
+)
+
+// breaker is a consecutive failures circuit breaker. Once open, it rejects
+// calls until the cooldown elapses, then lets a single call through to probe
+// whether the engine recovered.
+type breaker struct {
+	threshold int
+	cooldown  time.Duration
+	failures  int
+	openedAt  time.Time
+	probing   bool
+	mutex     *sync.Mutex
+}
+
+func newBreaker(threshold int, cooldown time.Duration) *breaker {
+	if threshold < 1 {
+		threshold = 1
+	}
+
+	return &breaker{threshold: threshold, cooldown: cooldown, mutex: &sync.Mutex{}}
+}
+
+func (b *breaker) allow() bool {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if b.failures < b.threshold {
+		return true
+	}
+
+	if b.probing || time.Since(b.openedAt) < b.cooldown {
+		return false
+	}
+
+	b.probing = true
+	return true
+}
+
+func (b *breaker) success() {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	b.failures = 0
+	b.probing = false
+}
+
+func (b *breaker) failure() {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	b.failures++
+	b.probing = false
+	if b.failures >= b.threshold {
+		b.openedAt = time.Now()
+	}
+}
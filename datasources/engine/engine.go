@@ -0,0 +1,111 @@
+package engine
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+var (
+	ErrCircuitOpen  = errors.New("EngineCircuitOpen")
+	ErrInvalidNonce = errors.New("InvalidEngineNonce")
+)
+
+type Config struct {
+	URL              string
+	Timeout          time.Duration
+	Retries          int
+	Backoff          time.Duration
+	BreakerThreshold int
+	BreakerCooldown  time.Duration
+}
+
+// NonceResponse is the response of the engine nonce endpoint.
+type NonceResponse struct {
+	Data struct {
+		Data *int64 `json:"data"`
+	} `json:"data"`
+}
+
+// Client is the matching engine HTTP client.
+type Client struct {
+	config  Config
+	http    *http.Client
+	breaker *breaker
+}
+
+func NewClient(c Config) *Client {
+	return &Client{
+		config:  c,
+		http:    &http.Client{},
+		breaker: newBreaker(c.BreakerThreshold, c.BreakerCooldown),
+	}
+}
+
+// FetchNonce returns the latest nonce of the matching engine. Any error means
+// the nonce is unknown and must not be used to take decisions.
+func (c *Client) FetchNonce(ctx context.Context) (int64, error) {
+	res := NonceResponse{}
+	if err := c.get(ctx, "/api/v1/activities/nonce", &res); err != nil {
+		return 0, err
+	}
+
+	if res.Data.Data == nil {
+		return 0, ErrInvalidNonce
+	}
+
+	return *res.Data.Data, nil
+}
+
+// get fetches the path and decodes its JSON body into v, retrying with
+// exponential backoff while the circuit breaker allows it.
+func (c *Client) get(ctx context.Context, path string, v interface{}) error {
+	var err error
+	for attempt := 0; attempt <= c.config.Retries; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(c.config.Backoff << (attempt - 1)):
+			}
+		}
+
+		if !c.breaker.allow() {
+			return ErrCircuitOpen
+		}
+
+		if err = c.do(ctx, path, v); err == nil {
+			c.breaker.success()
+			return nil
+		}
+
+		c.breaker.failure()
+	}
+
+	return err
+}
+
+func (c *Client) do(ctx context.Context, path string, v interface{}) error {
+	ctx, cancel := context.WithTimeout(ctx, c.config.Timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.config.URL+path, nil)
+	if err != nil {
+		return err
+	}
+
+	res, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("engine responded with %s", res.Status)
+	}
+
+	return json.NewDecoder(res.Body).Decode(v)
+}
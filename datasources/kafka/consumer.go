@@ -3,6 +3,7 @@ package kafka
 import (
 	"context"
 	"fmt"
+	"sync"
 	"time"
 
 	"github.com/Undercurrent-Technologies/kprime-utilities/commons/log"
@@ -14,33 +15,107 @@ import (
 var logger = log.Logger
 var groupID = "gateway-group"
 
-func InitConsumer(url string) *kafka.Reader {
+// consumerTopics are the topics consumed by pickup, each with its own reader
+// so that they can be paused and seeked independently.
+var consumerTopics = []types.Topic{types.ENGINE, types.CANCELLED_ORDER}
+
+type consumer struct {
+	topic  string
+	reader *kafka.Reader
+	paused bool
+	cancel context.CancelFunc
+	mutex  *sync.Mutex
+	cond   *sync.Cond
+}
+
+func InitConsumer(url, topic string) *kafka.Reader {
 	config := kafka.ReaderConfig{
 		Brokers:        []string{url},
 		GroupID:        groupID,
-		GroupTopics:    []string{types.ENGINE.String(), types.CANCELLED_ORDER.String()},
+		GroupTopics:    []string{topic},
 		CommitInterval: 10 * time.Millisecond,
 	}
 
 	return kafka.NewReader(config)
 }
 
+func newConsumer(url, topic string) *consumer {
+	mutex := &sync.Mutex{}
+	return &consumer{
+		topic:  topic,
+		reader: InitConsumer(url, topic),
+		mutex:  mutex,
+		cond:   sync.NewCond(mutex),
+	}
+}
+
+// next blocks while the consumer is paused and returns the current reader with
+// a context that is cancelled as soon as the consumer is paused again.
+func (c *consumer) next() (*kafka.Reader, context.Context) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	for c.paused {
+		c.cond.Wait()
+	}
+
+	if c.cancel != nil {
+		c.cancel()
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	c.cancel = cancel
+
+	return c.reader, ctx
+}
+
+// pause must be called with the consumer mutex held.
+func (c *consumer) pause() {
+	c.paused = true
+	if c.cancel != nil {
+		c.cancel()
+	}
+}
+
+// resume must be called with the consumer mutex held.
+func (c *consumer) resume() {
+	c.paused = false
+	c.cond.Broadcast()
+}
+
+func (c *consumer) current() *kafka.Reader {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return c.reader
+}
+
 func (k *Kafka) Subscribe(cb func(kafka.Message)) {
-	go func() {
-		for {
-			m, e := k.reader.FetchMessage(context.Background())
-			if e != nil {
-				logger.Errorf("Failed to fetch message!")
-				continue
+	for _, c := range k.consumers {
+		go func(c *consumer) {
+			for {
+				r, ctx := c.next()
+				m, e := r.FetchMessage(ctx)
+				if e != nil {
+					if ctx.Err() == nil {
+						logger.Errorf("Failed to fetch message!")
+					}
+					continue
+				}
+
+				go cb(m)
 			}
-
-			go cb(m)
-		}
-	}()
+		}(c)
+	}
 }
 
 func (k *Kafka) Commit(msg kafka.Message) error {
-	e := k.reader.CommitMessages(context.Background(), msg)
+	c, err := k.consumer(msg.Topic)
+	if err != nil {
+		return err
+	}
+
+	e := c.current().CommitMessages(context.Background(), msg)
 	if e != nil {
 		logger.Errorf("Failed to commit message!")
 		return e
@@ -0,0 +1,155 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+var ErrTopicNotFound = errors.New("TopicNotFound")
+
+type ConsumerStatus struct {
+	Topic  string `json:"topic"`
+	Paused bool   `json:"paused"`
+}
+
+func (k *Kafka) consumer(topic string) (*consumer, error) {
+	c, ok := k.consumers[topic]
+	if !ok {
+		return nil, ErrTopicNotFound
+	}
+
+	return c, nil
+}
+
+// Consumers returns the consumption status of every subscribed topic.
+func (k *Kafka) Consumers() []ConsumerStatus {
+	res := []ConsumerStatus{}
+	for _, t := range consumerTopics {
+		c := k.consumers[t.String()]
+		c.mutex.Lock()
+		res = append(res, ConsumerStatus{Topic: c.topic, Paused: c.paused})
+		c.mutex.Unlock()
+	}
+
+	return res
+}
+
+// Pause stops fetching new messages from the topic. Messages already fetched
+// are still handled.
+func (k *Kafka) Pause(topic string) error {
+	c, err := k.consumer(topic)
+	if err != nil {
+		return err
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.pause()
+	logger.Infof("Consumer %s paused", topic)
+
+	return nil
+}
+
+func (k *Kafka) Resume(topic string) error {
+	c, err := k.consumer(topic)
+	if err != nil {
+		return err
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.resume()
+	logger.Infof("Consumer %s resumed", topic)
+
+	return nil
+}
+
+// Seek moves the committed offset of the consumer group for the given
+// partition of the topic. The reader is recreated so that consumption
+// continues from the new offset, keeping the paused state unchanged.
+func (k *Kafka) Seek(topic string, partition int, offset int64) error {
+	c, err := k.consumer(topic)
+	if err != nil {
+		return err
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	paused := c.paused
+	c.pause()
+
+	if err := c.reader.Close(); err != nil {
+		logger.Errorf(err.Error())
+	}
+
+	err = k.commitOffset(topic, partition, offset)
+	c.reader = InitConsumer(k.url, topic)
+
+	if !paused {
+		c.resume()
+	}
+
+	if err != nil {
+		return err
+	}
+
+	logger.Infof("Consumer %s partition %d seeked to offset %d", topic, partition, offset)
+
+	return nil
+}
+
+// CommittedOffset returns the offset committed by the consumer group for the
+// partition of the topic, which is -1 when nothing has been committed yet.
+func (k *Kafka) CommittedOffset(topic string, partition int) (int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	client := &kafka.Client{Addr: kafka.TCP(k.url)}
+	res, err := client.OffsetFetch(ctx, &kafka.OffsetFetchRequest{
+		GroupID: groupID,
+		Topics:  map[string][]int{topic: {partition}},
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	if res.Error != nil {
+		return 0, res.Error
+	}
+
+	for _, p := range res.Topics[topic] {
+		if p.Partition == partition {
+			return p.CommittedOffset, p.Error
+		}
+	}
+
+	return -1, nil
+}
+
+func (k *Kafka) commitOffset(topic string, partition int, offset int64) error {
+	group, err := kafka.NewConsumerGroup(kafka.ConsumerGroupConfig{
+		ID:      groupID,
+		Brokers: []string{k.url},
+		Topics:  []string{topic},
+	})
+	if err != nil {
+		return err
+	}
+	defer group.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	gen, err := group.Next(ctx)
+	if err != nil {
+		return err
+	}
+
+	return gen.CommitOffsets(map[string]map[int]int64{topic: {partition: offset}})
+}
@@ -12,8 +12,9 @@ import (
 )
 
 type Kafka struct {
-	reader *kafka.Reader
-	writer *kafka.Writer
+	url       string
+	consumers map[string]*consumer
+	writer    *kafka.Writer
 }
 
 func InitConnection(url string, topics ...types.Topic) (*Kafka, error) {
@@ -65,8 +66,10 @@ func InitConnection(url string, topics ...types.Topic) (*Kafka, error) {
 	// Create non existing topics
 	_ = controllerConn.CreateTopics(topicConfig...)
 
-	k := &Kafka{}
-	k.reader = InitConsumer(url)
+	k := &Kafka{url: url, consumers: map[string]*consumer{}}
+	for _, t := range consumerTopics {
+		k.consumers[t.String()] = newConsumer(url, t.String())
+	}
 	k.writer = InitProducer(url)
 
 	logger.Infof("Kafka connected!")
@@ -82,12 +85,13 @@ func (k *Kafka) CloseConnection() {
 		sig := <-sigchnl
 		if sig == syscall.SIGTERM || sig == syscall.SIGINT {
 			logger.Infof("Close kafka connection...")
-			err := k.reader.Close()
-			if err != nil {
-				logger.Errorf(err.Error())
+			for _, c := range k.consumers {
+				if err := c.current().Close(); err != nil {
+					logger.Errorf(err.Error())
+				}
 			}
 
-			err = k.writer.Close()
+			err := k.writer.Close()
 			if err != nil {
 				logger.Errorf(err.Error())
 			}
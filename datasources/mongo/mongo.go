@@ -46,6 +46,10 @@ func InitConnection(uri string) error {
 	return nil
 }
 
+func (db *MongoDB) DB() *mongo.Database {
+	return db.Client.Database(app.Config.Mongo.Database)
+}
+
 func (db *MongoDB) InitCollection(collectionName string) *mongo.Collection {
 	return db.Client.Database(app.Config.Mongo.Database).Collection(collectionName)
 }
@@ -0,0 +1,86 @@
+package mongo
+
+import (
+	"context"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Repository is a typed repository over a collection owned by pickup.
+type Repository[T any] struct {
+	collection *mongo.Collection
+}
+
+func NewRepository[T any](db *MongoDB, collectionName string) *Repository[T] {
+	return &Repository[T]{collection: db.InitCollection(collectionName)}
+}
+
+func (r *Repository[T]) Collection() *mongo.Collection {
+	return r.collection
+}
+
+func (r *Repository[T]) FindOne(filter bson.M, opts ...*options.FindOneOptions) *T {
+	var res T
+	if err := r.collection.FindOne(context.Background(), filter, opts...).Decode(&res); err != nil {
+		if err != mongo.ErrNoDocuments {
+			logger.Errorf("Failed to find document: %v", err)
+		}
+		return nil
+	}
+
+	return &res
+}
+
+func (r *Repository[T]) Find(filter bson.M, opts ...*options.FindOptions) ([]T, error) {
+	cursor, err := r.collection.Find(context.Background(), filter, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	res := []T{}
+	if err := cursor.All(context.Background(), &res); err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+func (r *Repository[T]) Create(data *T) error {
+	_, err := r.collection.InsertOne(context.Background(), data)
+	return err
+}
+
+func (r *Repository[T]) FindAndModify(filter bson.M, update bson.M) (*T, error) {
+	opts := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)
+
+	var res T
+	if err := r.collection.FindOneAndUpdate(context.Background(), filter, update, opts).Decode(&res); err != nil {
+		return nil, err
+	}
+
+	return &res, nil
+}
+
+// Update updates the first document matching the filter without upserting and
+// reports whether a document matched.
+func (r *Repository[T]) Update(filter bson.M, update bson.M) (bool, error) {
+	res, err := r.collection.UpdateOne(context.Background(), filter, update)
+	if err != nil {
+		return false, err
+	}
+
+	return res.MatchedCount > 0, nil
+}
+
+// Aggregate runs the pipeline and decodes all results into res, which may
+// differ from the documents of the collection.
+func (r *Repository[T]) Aggregate(pipeline []bson.M, res interface{}) error {
+	cursor, err := r.collection.Aggregate(context.Background(), pipeline)
+	if err != nil {
+		return err
+	}
+
+	return cursor.All(context.Background(), res)
+}
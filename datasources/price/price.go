@@ -0,0 +1,115 @@
+package price
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+var ErrPriceNotFound = errors.New("SettlementPriceNotFound")
+
+// Source provides the settlement price of an underlying at an expiry.
+type Source interface {
+	SettlementPrice(ctx context.Context, underlying string, expiry time.Time) (decimal.Decimal, error)
+}
+
+// Price is a settlement price of the price source.
+type Price struct {
+	Underlying string          `json:"underlying"`
+	Expiry     time.Time       `json:"expiry"`
+	Price      decimal.Decimal `json:"price"`
+}
+
+// PriceResponse is the response of the settlement price endpoint.
+type PriceResponse struct {
+	Data *Price `json:"data"`
+}
+
+// PricesResponse is the format of the settlement price file.
+type PricesResponse struct {
+	Data []Price `json:"data"`
+}
+
+// HTTPSource fetches settlement prices from
+// GET {url}/api/v1/settlement-prices?underlying={underlying}&expiry={expiry}.
+type HTTPSource struct {
+	url  string
+	http *http.Client
+}
+
+func NewHTTPSource(url string, timeout time.Duration) *HTTPSource {
+	return &HTTPSource{url: url, http: &http.Client{Timeout: timeout}}
+}
+
+func (s *HTTPSource) SettlementPrice(ctx context.Context, underlying string, expiry time.Time) (decimal.Decimal, error) {
+	q := url.Values{}
+	q.Set("underlying", underlying)
+	q.Set("expiry", expiry.UTC().Format(time.RFC3339))
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.url+"/api/v1/settlement-prices?"+q.Encode(), nil)
+	if err != nil {
+		return decimal.Zero, err
+	}
+
+	resp, err := s.http.Do(req)
+	if err != nil {
+		return decimal.Zero, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return decimal.Zero, ErrPriceNotFound
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return decimal.Zero, fmt.Errorf("settlement price source responded %d", resp.StatusCode)
+	}
+
+	res := PriceResponse{}
+	if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
+		return decimal.Zero, err
+	}
+
+	if res.Data == nil {
+		return decimal.Zero, ErrPriceNotFound
+	}
+
+	return res.Data.Price, nil
+}
+
+// FileSource serves settlement prices from a JSON file, to settle locally
+// without a price service.
+type FileSource struct {
+	path string
+}
+
+func NewFileSource(path string) *FileSource {
+	return &FileSource{path: path}
+}
+
+func (s *FileSource) SettlementPrice(ctx context.Context, underlying string, expiry time.Time) (decimal.Decimal, error) {
+	data, err := os.ReadFile(s.path)
+	if err != nil {
+		return decimal.Zero, err
+	}
+
+	res := PricesResponse{}
+	if err := json.Unmarshal(data, &res); err != nil {
+		return decimal.Zero, err
+	}
+
+	for _, p := range res.Data {
+		if p.Underlying == underlying && p.Expiry.Equal(expiry) {
+			return p.Price, nil
+		}
+	}
+
+	return decimal.Zero, ErrPriceNotFound
+}
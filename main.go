@@ -1,7 +1,22 @@
 package main
 
-import "pickup/server"
+import (
+	"os"
+	"pickup/server"
+)
 
 func main() {
-	server.Start()
+	command := ""
+	if len(os.Args) > 1 {
+		command = os.Args[1]
+	}
+
+	switch command {
+	case "verify":
+		server.Verify()
+	case "migrate":
+		server.Migrate()
+	default:
+		server.Start()
+	}
 }
@@ -0,0 +1,137 @@
+package migrations
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Undercurrent-Technologies/kprime-utilities/commons/log"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var logger = log.Logger
+
+var ErrDuplicates = errors.New("Duplicates")
+
+const collection = "pickup_migrations"
+
+// Migration is a versioned change of the database. Up must be idempotent, so
+// that a migration interrupted before being recorded can run again.
+type Migration struct {
+	Version     int
+	Description string
+	Up          func(ctx context.Context, db *mongo.Database) error
+}
+
+type record struct {
+	Version     int       `bson:"_id"`
+	Description string    `bson:"description"`
+	AppliedAt   time.Time `bson:"appliedAt"`
+}
+
+// Run applies the migrations which have not been recorded yet, in version order.
+func Run(db *mongo.Database) error {
+	ctx := context.Background()
+	c := db.Collection(collection)
+
+	for _, m := range migrations {
+		err := c.FindOne(ctx, bson.M{"_id": m.Version}).Err()
+		if err == nil {
+			continue
+		}
+
+		if !errors.Is(err, mongo.ErrNoDocuments) {
+			return err
+		}
+
+		logger.Infof("Applying migration %d: %s", m.Version, m.Description)
+		if err := m.Up(ctx, db); err != nil {
+			return err
+		}
+
+		r := record{Version: m.Version, Description: m.Description, AppliedAt: time.Now()}
+		if _, err := c.InsertOne(ctx, r); err != nil {
+			return err
+		}
+	}
+
+	logger.Infof("Database migrated!")
+
+	return nil
+}
+
+// checkDuplicates aborts with the duplicated values of the field, which must
+// be resolved before a unique index can be created on it.
+func checkDuplicates(ctx context.Context, db *mongo.Database, name, field string) error {
+	pipeline := []bson.M{
+		{"$group": bson.M{"_id": "$" + field, "count": bson.M{"$sum": 1}}},
+		{"$match": bson.M{"count": bson.M{"$gt": 1}}},
+		{"$sort": bson.M{"_id": 1}},
+		{"$limit": 20},
+	}
+
+	cursor, err := db.Collection(name).Aggregate(ctx, pipeline, options.Aggregate().SetAllowDiskUse(true))
+	if err != nil {
+		return err
+	}
+
+	duplicates := []struct {
+		Value interface{} `bson:"_id"`
+		Count int         `bson:"count"`
+	}{}
+	if err := cursor.All(ctx, &duplicates); err != nil {
+		return err
+	}
+
+	if len(duplicates) == 0 {
+		return nil
+	}
+
+	values := make([]string, len(duplicates))
+	for i, d := range duplicates {
+		values[i] = fmt.Sprintf("%v (%d documents)", d.Value, d.Count)
+	}
+
+	return fmt.Errorf(
+		"%w: %s has duplicated %s values, remove the duplicates before migrating again: %s",
+		ErrDuplicates, name, field, strings.Join(values, ", "),
+	)
+}
+
+func createIndexes(ctx context.Context, db *mongo.Database, name string, indexes ...mongo.IndexModel) error {
+	_, err := db.Collection(name).Indexes().CreateMany(ctx, indexes)
+	return err
+}
+
+// setValidator creates the collection when missing and applies the JSON
+// schema validator. Collections shared with other services only warn on
+// invalid documents.
+func setValidator(ctx context.Context, db *mongo.Database, name string, schema bson.M, action string) error {
+	err := db.CreateCollection(ctx, name)
+	var cmdErr mongo.CommandError
+	if err != nil && !(errors.As(err, &cmdErr) && cmdErr.Name == "NamespaceExists") {
+		return err
+	}
+
+	cmd := bson.D{
+		{Key: "collMod", Value: name},
+		{Key: "validator", Value: bson.M{"$jsonSchema": schema}},
+		{Key: "validationLevel", Value: "moderate"},
+		{Key: "validationAction", Value: action},
+	}
+
+	return db.RunCommand(ctx, cmd).Err()
+}
+
+func index(keys bson.D, unique bool) mongo.IndexModel {
+	m := mongo.IndexModel{Keys: keys}
+	if unique {
+		m.Options = options.Index().SetUnique(true)
+	}
+
+	return m
+}
@@ -0,0 +1,321 @@
+package migrations
+
+import (
+	"context"
+	"errors"
+	"pickup/models/archive"
+	"pickup/models/audit"
+	"pickup/models/chain"
+	"pickup/models/collateral"
+	"pickup/models/fee"
+	"pickup/models/offset"
+	"pickup/models/position"
+	"pickup/models/rejection"
+	"pickup/models/reservation"
+	"pickup/models/settlement"
+	"pickup/models/status"
+
+	"github.com/Undercurrent-Technologies/kprime-utilities/types"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Collections owned by other services
+const (
+	orders = "orders"
+	trades = "trades"
+)
+
+// indexNotFound is the code of the error dropping a missing index.
+const indexNotFound = 27
+
+var migrations = []Migration{
+	{
+		Version:     1,
+		Description: "Create activity indexes",
+		Up: func(ctx context.Context, db *mongo.Database) error {
+			if err := checkDuplicates(ctx, db, chain.Collection, "nonce"); err != nil {
+				return err
+			}
+
+			return createIndexes(ctx, db, chain.Collection,
+				index(bson.D{{Key: "nonce", Value: 1}}, true),
+				index(bson.D{{Key: "createdAt", Value: -1}}, false),
+				index(bson.D{{Key: "kafkaOffset", Value: -1}}, false),
+			)
+		},
+	},
+	{
+		Version:     2,
+		Description: "Create order and trade indexes",
+		Up: func(ctx context.Context, db *mongo.Database) error {
+			err := createIndexes(ctx, db, trades,
+				index(bson.D{{Key: "taker.userId", Value: 1}, {Key: "createdAt", Value: 1}}, false),
+				index(bson.D{{Key: "maker.userId", Value: 1}, {Key: "createdAt", Value: 1}}, false),
+			)
+			if err != nil {
+				return err
+			}
+
+			return createIndexes(ctx, db, orders,
+				index(bson.D{{Key: "userId", Value: 1}, {Key: "status", Value: 1}}, false),
+			)
+		},
+	},
+	{
+		Version:     3,
+		Description: "Create pickup collection indexes",
+		Up: func(ctx context.Context, db *mongo.Database) error {
+			for _, name := range []string{archive.IndexCollection, archive.ArchiveCollection} {
+				if err := checkDuplicates(ctx, db, name, "nonce"); err != nil {
+					return err
+				}
+			}
+
+			err := createIndexes(ctx, db, archive.IndexCollection,
+				index(bson.D{{Key: "nonce", Value: 1}}, true),
+			)
+			if err != nil {
+				return err
+			}
+
+			err = createIndexes(ctx, db, archive.ArchiveCollection,
+				index(bson.D{{Key: "nonce", Value: 1}}, true),
+			)
+			if err != nil {
+				return err
+			}
+
+			err = createIndexes(ctx, db, audit.Collection,
+				index(bson.D{{Key: "createdAt", Value: -1}}, false),
+			)
+			if err != nil {
+				return err
+			}
+
+			return createIndexes(ctx, db, status.Collection,
+				index(bson.D{{Key: "createdAt", Value: -1}}, false),
+			)
+		},
+	},
+	{
+		Version:     4,
+		Description: "Add activity and pickup collection validators",
+		Up: func(ctx context.Context, db *mongo.Database) error {
+			err := setValidator(ctx, db, chain.Collection, bson.M{
+				"bsonType": "object",
+				"required": []string{"nonce", "kafkaOffset", "createdAt"},
+				"properties": bson.M{
+					"nonce":       bson.M{"bsonType": []string{"int", "long"}, "minimum": 1},
+					"kafkaOffset": bson.M{"bsonType": []string{"int", "long"}},
+					"createdAt":   bson.M{"bsonType": "date"},
+					"hash":        bson.M{"bsonType": "string"},
+					"prevHash":    bson.M{"bsonType": "string"},
+				},
+			}, "warn")
+			if err != nil {
+				return err
+			}
+
+			err = setValidator(ctx, db, archive.IndexCollection, bson.M{
+				"bsonType": "object",
+				"required": []string{"nonce", "kafkaOffset", "location", "archivedAt"},
+				"properties": bson.M{
+					"nonce":       bson.M{"bsonType": []string{"int", "long"}},
+					"kafkaOffset": bson.M{"bsonType": []string{"int", "long"}},
+					"location":    bson.M{"bsonType": "string"},
+					"archivedAt":  bson.M{"bsonType": "date"},
+				},
+			}, "error")
+			if err != nil {
+				return err
+			}
+
+			err = setValidator(ctx, db, audit.Collection, bson.M{
+				"bsonType": "object",
+				"required": []string{"actor", "action", "createdAt"},
+				"properties": bson.M{
+					"actor":     bson.M{"bsonType": "string"},
+					"action":    bson.M{"bsonType": "string"},
+					"createdAt": bson.M{"bsonType": "date"},
+				},
+			}, "error")
+			if err != nil {
+				return err
+			}
+
+			return setValidator(ctx, db, status.Collection, bson.M{
+				"bsonType": "object",
+				"required": []string{"oldStatus", "newStatus", "reason", "createdAt"},
+				"properties": bson.M{
+					"oldStatus": bson.M{"bsonType": "string"},
+					"newStatus": bson.M{"bsonType": "string"},
+					"reason":    bson.M{"bsonType": "string"},
+					"createdAt": bson.M{"bsonType": "date"},
+				},
+			}, "error")
+		},
+	},
+	{
+		Version:     5,
+		Description: "Create reservation indexes",
+		Up: func(ctx context.Context, db *mongo.Database) error {
+			err := createIndexes(ctx, db, reservation.OrderCollection,
+				index(bson.D{{Key: "userId", Value: 1}, {Key: "currency", Value: 1}}, false),
+			)
+			if err != nil {
+				return err
+			}
+
+			return createIndexes(ctx, db, reservation.BalanceCollection,
+				index(bson.D{{Key: "userId", Value: 1}, {Key: "currency", Value: 1}}, true),
+			)
+		},
+	},
+	{
+		Version:     6,
+		Description: "Create position indexes",
+		Up: func(ctx context.Context, db *mongo.Database) error {
+			return createIndexes(ctx, db, position.Collection,
+				index(bson.D{{Key: "userId", Value: 1}, {Key: "instrumentName", Value: 1}}, true),
+			)
+		},
+	},
+	{
+		Version:     7,
+		Description: "Create settlement indexes",
+		Up: func(ctx context.Context, db *mongo.Database) error {
+			return createIndexes(ctx, db, settlement.Collection,
+				index(bson.D{{Key: "userId", Value: 1}, {Key: "instrumentName", Value: 1}}, true),
+				index(bson.D{{Key: "userId", Value: 1}, {Key: "createdAt", Value: -1}}, false),
+			)
+		},
+	},
+	{
+		Version:     8,
+		Description: "Create fee indexes",
+		Up: func(ctx context.Context, db *mongo.Database) error {
+			return createIndexes(ctx, db, fee.Collection,
+				index(bson.D{{Key: "tradeId", Value: 1}, {Key: "role", Value: 1}}, true),
+				index(bson.D{{Key: "currency", Value: 1}, {Key: "tradedAt", Value: 1}}, false),
+			)
+		},
+	},
+	{
+		Version:     9,
+		Description: "Create rejected order indexes",
+		Up: func(ctx context.Context, db *mongo.Database) error {
+			return createIndexes(ctx, db, rejection.Collection,
+				index(bson.D{{Key: "nonce", Value: 1}}, false),
+			)
+		},
+	},
+	{
+		Version:     10,
+		Description: "Add order, trade and user validators",
+		Up: func(ctx context.Context, db *mongo.Database) error {
+			decimal := bson.M{"bsonType": []string{"string", "decimal", "double", "int", "long"}}
+			err := setValidator(ctx, db, orders, bson.M{
+				"bsonType": "object",
+				"required": []string{"userId", "side", "status"},
+				"properties": bson.M{
+					"userId":       bson.M{"bsonType": "objectId"},
+					"side":         bson.M{"bsonType": "string"},
+					"status":       bson.M{"bsonType": "string"},
+					"price":        decimal,
+					"amount":       decimal,
+					"filledAmount": decimal,
+				},
+			}, "warn")
+			if err != nil {
+				return err
+			}
+
+			err = setValidator(ctx, db, trades, bson.M{
+				"bsonType": "object",
+				"required": []string{"taker", "maker", "status"},
+				"properties": bson.M{
+					"taker":  bson.M{"bsonType": "object", "required": []string{"userId"}},
+					"maker":  bson.M{"bsonType": "object", "required": []string{"userId"}},
+					"status": bson.M{"bsonType": "string"},
+					"price":  decimal,
+					"amount": decimal,
+				},
+			}, "warn")
+			if err != nil {
+				return err
+			}
+
+			return setValidator(ctx, db, collateral.Collection, bson.M{
+				"bsonType": "object",
+				"properties": bson.M{
+					"collaterals": bson.M{"bsonType": "object"},
+					"version":     bson.M{"bsonType": []string{"int", "long"}},
+				},
+			}, "warn")
+		},
+	},
+	{
+		Version:     11,
+		Description: "Seed positions of unknown cost from user contracts",
+		Up:          seedPositions,
+	},
+	{
+		Version:     12,
+		Description: "Store the topic of activities",
+		Up: func(ctx context.Context, db *mongo.Database) error {
+			// Only cancelled order activities carry a query
+			c := db.Collection(chain.Collection)
+			topics := map[string]bool{types.CANCELLED_ORDER.String(): true, types.ENGINE.String(): false}
+			for topic, query := range topics {
+				filter := bson.M{"topic": bson.M{"$exists": false}, "data.query": bson.M{"$exists": query}}
+				if _, err := c.UpdateMany(ctx, filter, bson.M{"$set": bson.M{"topic": topic}}); err != nil {
+					return err
+				}
+			}
+
+			return createIndexes(ctx, db, chain.Collection,
+				index(bson.D{{Key: "topic", Value: 1}, {Key: "kafkaOffset", Value: -1}}, false),
+				index(bson.D{{Key: "topic", Value: 1}, {Key: "nonce", Value: 1}}, false),
+			)
+		},
+	},
+	{
+		Version:     13,
+		Description: "Create processed offset indexes",
+		Up: func(ctx context.Context, db *mongo.Database) error {
+			err := createIndexes(ctx, db, offset.Collection,
+				index(bson.D{{Key: "topic", Value: 1}, {Key: "partition", Value: 1}}, true),
+			)
+			if err != nil {
+				return err
+			}
+
+			return createIndexes(ctx, db, archive.IndexCollection,
+				index(bson.D{{Key: "topic", Value: 1}, {Key: "kafkaOffset", Value: -1}}, false),
+			)
+		},
+	},
+	{
+		Version:     14,
+		Description: "Key settlements by sequence",
+		Up: func(ctx context.Context, db *mongo.Database) error {
+			c := db.Collection(settlement.Collection)
+			if _, err := c.UpdateMany(ctx, bson.M{"sequence": bson.M{"$exists": false}}, bson.M{"$set": bson.M{"sequence": 0}}); err != nil {
+				return err
+			}
+
+			// Unique by user and instrument before sequences
+			if _, err := c.Indexes().DropOne(ctx, "userId_1_instrumentName_1"); err != nil {
+				var cmd mongo.CommandError
+				if !errors.As(err, &cmd) || cmd.Code != indexNotFound {
+					return err
+				}
+			}
+
+			return createIndexes(ctx, db, settlement.Collection,
+				index(bson.D{{Key: "userId", Value: 1}, {Key: "instrumentName", Value: 1}, {Key: "sequence", Value: -1}}, true),
+			)
+		},
+	},
+}
@@ -0,0 +1,84 @@
+package migrations
+
+import (
+	"context"
+	"pickup/models/collateral"
+	"pickup/models/position"
+	"time"
+
+	"github.com/Undercurrent-Technologies/kprime-utilities/models/user"
+	"github.com/shopspring/decimal"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// seedPositions creates the positions of the contracts held before positions
+// were tracked with an unknown cost. Tracked positions whose amount differs
+// from the contract include such contracts, their amount is set to the
+// contract amount and their cost becomes unknown.
+func seedPositions(ctx context.Context, db *mongo.Database) error {
+	positions := db.Collection(position.Collection)
+
+	filter := bson.M{"collaterals.contracts.0": bson.M{"$exists": true}}
+	cursor, err := db.Collection(collateral.Collection).Find(ctx, filter)
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		u := user.User{}
+		if err := cursor.Decode(&u); err != nil {
+			return err
+		}
+
+		for _, c := range u.Collaterals.Contracts {
+			amount := c.GetAmount()
+			if amount.IsZero() {
+				continue
+			}
+
+			if err := seedPosition(ctx, positions, u.ID, c.InstrumentName, amount); err != nil {
+				return err
+			}
+		}
+	}
+
+	return cursor.Err()
+}
+
+func seedPosition(ctx context.Context, positions *mongo.Collection, userID primitive.ObjectID, instrument string, amount decimal.Decimal) error {
+	filter := bson.M{"userId": userID, "instrumentName": instrument}
+
+	p := position.Position{}
+	err := positions.FindOne(ctx, filter).Decode(&p)
+	if err != nil && err != mongo.ErrNoDocuments {
+		return err
+	}
+
+	if err == nil {
+		if current, _ := decimal.NewFromString(p.Amount); current.Equal(amount) {
+			return nil
+		}
+	}
+
+	update := bson.M{
+		"$set": bson.M{
+			"amount":       amount.String(),
+			"averagePrice": "0",
+			"costBasis":    "0",
+			"unknownCost":  true,
+			"updatedAt":    time.Now(),
+		},
+		"$setOnInsert": bson.M{
+			"_id":         primitive.NewObjectID(),
+			"realizedPnl": "0",
+			"fees":        "0",
+		},
+	}
+	_, err = positions.UpdateOne(ctx, filter, update, options.Update().SetUpsert(true))
+
+	return err
+}
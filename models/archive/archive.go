@@ -0,0 +1,28 @@
+package archive
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	IndexCollection   = "activity_indexes"
+	ArchiveCollection = "activity_archives"
+
+	ModeFile       = "file"
+	ModeCollection = "collection"
+)
+
+// Index keeps the nonce to kafka offset mapping of an archived activity.
+type Index struct {
+	ID          primitive.ObjectID `json:"id" bson:"_id"`
+	Nonce       int64              `json:"nonce" bson:"nonce"`
+	KafkaOffset int64              `json:"kafkaOffset" bson:"kafkaOffset"`
+	Topic       string             `json:"topic" bson:"topic"`
+	Hash        string             `json:"hash,omitempty" bson:"hash,omitempty"`
+	OutOfOrder  bool               `json:"outOfOrder,omitempty" bson:"outOfOrder,omitempty"`
+	Location    string             `json:"location" bson:"location"`
+	CreatedAt   time.Time          `json:"createdAt" bson:"createdAt"`
+	ArchivedAt  time.Time          `json:"archivedAt" bson:"archivedAt"`
+}
@@ -0,0 +1,22 @@
+package audit
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const Collection = "pickup_audits"
+
+// Audit records an action performed through the admin API. The actor is
+// declared by the caller, the key fingerprint and remote address are not.
+type Audit struct {
+	ID             primitive.ObjectID     `json:"id" bson:"_id"`
+	Actor          string                 `json:"actor" bson:"actor"`
+	KeyFingerprint string                 `json:"keyFingerprint" bson:"keyFingerprint"`
+	RemoteAddr     string                 `json:"remoteAddr" bson:"remoteAddr"`
+	Action         string                 `json:"action" bson:"action"`
+	Params         map[string]interface{} `json:"params" bson:"params"`
+	Error          string                 `json:"error,omitempty" bson:"error,omitempty"`
+	CreatedAt      time.Time              `json:"createdAt" bson:"createdAt"`
+}
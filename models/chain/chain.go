@@ -0,0 +1,65 @@
+package chain
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"time"
+
+	"github.com/Undercurrent-Technologies/kprime-utilities/models/activity"
+	"github.com/Undercurrent-Technologies/kprime-utilities/types"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Collection is the activity collection, the hash chain is stored on the
+// activity documents.
+const Collection = "activities"
+
+// CheckpointTopic receives the latest hash of the chain for external anchoring.
+const CheckpointTopic types.Topic = "ACTIVITY_CHECKPOINT"
+
+// Activity is an activity document with its source topic and hash chain
+// fields, the topic is not covered by the hash.
+type Activity struct {
+	activity.Activity `bson:",inline"`
+	Topic             string `json:"topic,omitempty" bson:"topic,omitempty"`
+	Hash              string `json:"hash" bson:"hash"`
+	PrevHash          string `json:"prevHash" bson:"prevHash"`
+	OutOfOrder        bool   `json:"outOfOrder,omitempty" bson:"outOfOrder,omitempty"`
+}
+
+// Link is the part of an activity document covered by the hash chain. Data is
+// kept as stored so that the hash can be computed again byte for byte.
+//
+// Links are never rewritten. An activity inserted after a higher nonce is an
+// out of order side entry chained to the previous in order link, the
+// following links still chain to that link.
+type Link struct {
+	ID          primitive.ObjectID `bson:"_id"`
+	Nonce       int64              `bson:"nonce"`
+	KafkaOffset int64              `bson:"kafkaOffset"`
+	Data        bson.RawValue      `bson:"data"`
+	Hash        string             `bson:"hash,omitempty"`
+	PrevHash    string             `bson:"prevHash,omitempty"`
+	OutOfOrder  bool               `bson:"outOfOrder,omitempty"`
+}
+
+type Checkpoint struct {
+	Nonce     int64     `json:"nonce"`
+	Hash      string    `json:"hash"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// ComputeHash returns the hex encoded SHA-256 of the previous hash, the nonce,
+// the kafka offset and the stored data of the activity.
+func (l *Link) ComputeHash() string {
+	h := sha256.New()
+	h.Write([]byte(l.PrevHash))
+	binary.Write(h, binary.BigEndian, l.Nonce)
+	binary.Write(h, binary.BigEndian, l.KafkaOffset)
+	h.Write([]byte{byte(l.Data.Type)})
+	h.Write(l.Data.Value)
+
+	return hex.EncodeToString(h.Sum(nil))
+}
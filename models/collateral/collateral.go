@@ -0,0 +1,24 @@
+package collateral
+
+import (
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Collection is the collection of the user documents.
+const Collection = "users"
+
+// AppliedTradesLimit is the number of latest applied trade sides kept on the
+// user document.
+const AppliedTradesLimit = 1000
+
+// User is the part of the user document holding the collaterals. The
+// collaterals are kept raw so that they can be compared exactly as stored.
+// AppliedTrades are the latest trade sides applied to the collaterals, written
+// together with them so that a trade side is applied once.
+type User struct {
+	ID            primitive.ObjectID `bson:"_id"`
+	Collaterals   bson.RawValue      `bson:"collaterals"`
+	Version       int64              `bson:"version"`
+	AppliedTrades []string           `bson:"appliedTrades,omitempty"`
+}
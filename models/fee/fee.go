@@ -0,0 +1,52 @@
+package fee
+
+import (
+	"time"
+
+	"github.com/shopspring/decimal"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	Collection        = "fees"
+	AccountCollection = "fee_accounts"
+)
+
+// Roles of the user in the trade, reversal roles refund the fee of failed trades
+const (
+	Taker         = "TAKER"
+	Maker         = "MAKER"
+	TakerReversal = "TAKER_REVERSAL"
+	MakerReversal = "MAKER_REVERSAL"
+)
+
+// Reversals are the reversal roles of the roles.
+var Reversals = map[string]string{Taker: TakerReversal, Maker: MakerReversal}
+
+// Fee is the fee charged to one side of a trade, negative for rebates.
+type Fee struct {
+	ID             primitive.ObjectID `json:"id" bson:"_id"`
+	TradeID        primitive.ObjectID `json:"tradeId" bson:"tradeId"`
+	UserID         primitive.ObjectID `json:"userId" bson:"userId"`
+	Role           string             `json:"role" bson:"role"`
+	InstrumentName string             `json:"instrumentName" bson:"instrumentName"`
+	Currency       string             `json:"currency" bson:"currency"`
+	Amount         string             `json:"amount" bson:"amount"`
+	TradedAt       time.Time          `json:"tradedAt" bson:"tradedAt"`
+	CreatedAt      time.Time          `json:"createdAt" bson:"createdAt"`
+}
+
+func (f *Fee) GetAmount() decimal.Decimal {
+	d, _ := decimal.NewFromString(f.Amount)
+	return d
+}
+
+// Account is the fee revenue of the exchange in a currency, the balance is
+// the collected fees minus the paid rebates.
+type Account struct {
+	Currency  string    `json:"currency" bson:"_id"`
+	Balance   string    `json:"balance" bson:"balance"`
+	Fees      string    `json:"fees" bson:"fees"`
+	Rebates   string    `json:"rebates" bson:"rebates"`
+	UpdatedAt time.Time `json:"updatedAt" bson:"updatedAt"`
+}
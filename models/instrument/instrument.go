@@ -0,0 +1,100 @@
+package instrument
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+var (
+	ErrInvalidInstrument = errors.New("InvalidInstrument")
+	ErrUnknownInstrument = errors.New("UnknownInstrument")
+	ErrExpiredInstrument = errors.New("ExpiredInstrument")
+)
+
+// Collection is the collection of the instruments listed by the exchange.
+const Collection = "instruments"
+
+var underlyingPattern = regexp.MustCompile(`^[A-Z0-9]+$`)
+
+// Option types
+const (
+	Call = "C"
+	Put  = "P"
+)
+
+// expiryLayout is the expiry date layout of instrument names, e.g. 30JUN23.
+const expiryLayout = "2Jan06"
+
+// ExpiryHour is the UTC hour at which options expire on their expiry date, set
+// from INSTRUMENT_EXPIRY_HOUR on startup.
+var ExpiryHour = 8
+
+// Instrument is an option parsed from its name, e.g. BTC-30JUN23-25000-C.
+type Instrument struct {
+	Name       string          `json:"name"`
+	Underlying string          `json:"underlying"`
+	Expiry     time.Time       `json:"expiry"`
+	Strike     decimal.Decimal `json:"strike"`
+	Type       string          `json:"type"`
+}
+
+// Record is an instrument listed by the exchange.
+type Record struct {
+	Name   string `bson:"name"`
+	Active *bool  `bson:"active,omitempty"`
+}
+
+// Parse parses an instrument name as UNDERLYING-EXPIRY-STRIKE-TYPE.
+func Parse(name string) (*Instrument, error) {
+	parts := strings.Split(name, "-")
+	if len(parts) != 4 || !underlyingPattern.MatchString(parts[0]) {
+		return nil, ErrInvalidInstrument
+	}
+
+	date, err := time.Parse(expiryLayout, parts[1])
+	if err != nil {
+		return nil, ErrInvalidInstrument
+	}
+
+	strike, err := decimal.NewFromString(parts[2])
+	if err != nil || !strike.IsPositive() {
+		return nil, ErrInvalidInstrument
+	}
+
+	if parts[3] != Call && parts[3] != Put {
+		return nil, ErrInvalidInstrument
+	}
+
+	return &Instrument{
+		Name:       name,
+		Underlying: parts[0],
+		Expiry:     date.Add(time.Duration(ExpiryHour) * time.Hour),
+		Strike:     strike,
+		Type:       parts[3],
+	}, nil
+}
+
+// Code returns the instrument name as formatted by the exchange, the strike
+// without trailing zeros, e.g. BTC-30JUN23-25000.0-C becomes BTC-30JUN23-25000-C.
+func (i *Instrument) Code() string {
+	date := strings.ToUpper(i.Expiry.Format(expiryLayout))
+	return strings.Join([]string{i.Underlying, date, i.Strike.String(), i.Type}, "-")
+}
+
+func (i *Instrument) Expired(now time.Time) bool {
+	return !now.Before(i.Expiry)
+}
+
+// Payoff returns the value of one contract settled at the given price.
+func (i *Instrument) Payoff(price decimal.Decimal) decimal.Decimal {
+	v := price.Sub(i.Strike)
+	if i.Type == Put {
+		v = v.Neg()
+	}
+
+	return decimal.Max(v, decimal.Zero)
+}
@@ -0,0 +1,118 @@
+package instrument
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name       string
+		underlying string
+		expiry     time.Time
+		strike     string
+		typ        string
+		err        error
+	}{
+		{"BTC-30JUN23-25000-C", "BTC", time.Date(2023, 6, 30, 8, 0, 0, 0, time.UTC), "25000", Call, nil},
+		{"ETH-1JUL23-1800.5-P", "ETH", time.Date(2023, 7, 1, 8, 0, 0, 0, time.UTC), "1800.5", Put, nil},
+		{"BTC-30JUN23-25000", "", time.Time{}, "", "", ErrInvalidInstrument},
+		{"btc-30JUN23-25000-C", "", time.Time{}, "", "", ErrInvalidInstrument},
+		{"BTC-31JUN23-25000-C", "", time.Time{}, "", "", ErrInvalidInstrument},
+		{"BTC-30JUN23-0-C", "", time.Time{}, "", "", ErrInvalidInstrument},
+		{"BTC-30JUN23-abc-C", "", time.Time{}, "", "", ErrInvalidInstrument},
+		{"BTC-30JUN23-25000-X", "", time.Time{}, "", "", ErrInvalidInstrument},
+		{"BTC-PERPETUAL", "", time.Time{}, "", "", ErrInvalidInstrument},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			i, err := Parse(tt.name)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("Parse() error = %v, want %v", err, tt.err)
+			}
+
+			if err != nil {
+				return
+			}
+
+			if i.Underlying != tt.underlying || !i.Expiry.Equal(tt.expiry) || !i.Strike.Equal(decimal.RequireFromString(tt.strike)) || i.Type != tt.typ {
+				t.Errorf("Parse() = %+v", i)
+			}
+		})
+	}
+}
+
+func TestCode(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"BTC-30JUN23-25000-C", "BTC-30JUN23-25000-C"},
+		{"BTC-30JUN23-25000.00-C", "BTC-30JUN23-25000-C"},
+		{"ETH-01JUL23-1800.50-P", "ETH-1JUL23-1800.5-P"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			i, err := Parse(tt.name)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got := i.Code(); got != tt.want {
+				t.Errorf("Code() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExpired(t *testing.T) {
+	i, err := Parse("BTC-30JUN23-25000-C")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		at   time.Time
+		want bool
+	}{
+		{time.Date(2023, 6, 30, 7, 59, 59, 0, time.UTC), false},
+		{time.Date(2023, 6, 30, 8, 0, 0, 0, time.UTC), true},
+		{time.Date(2023, 6, 30, 10, 0, 0, 0, time.FixedZone("CEST", 2*3600)), true},
+		{time.Date(2023, 7, 1, 0, 0, 0, 0, time.UTC), true},
+	}
+
+	for _, tt := range tests {
+		if got := i.Expired(tt.at); got != tt.want {
+			t.Errorf("Expired(%s) = %v, want %v", tt.at, got, tt.want)
+		}
+	}
+}
+
+func TestPayoff(t *testing.T) {
+	tests := []struct {
+		name  string
+		price string
+		want  string
+	}{
+		{"BTC-30JUN23-25000-C", "26000", "1000"},
+		{"BTC-30JUN23-25000-C", "24000", "0"},
+		{"BTC-30JUN23-25000-P", "24000", "1000"},
+		{"BTC-30JUN23-25000-P", "25000", "0"},
+	}
+
+	for _, tt := range tests {
+		i, err := Parse(tt.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if got := i.Payoff(decimal.RequireFromString(tt.price)); !got.Equal(decimal.RequireFromString(tt.want)) {
+			t.Errorf("%s Payoff(%s) = %s, want %s", tt.name, tt.price, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package notification
+
+import (
+	"time"
+
+	"github.com/Undercurrent-Technologies/kprime-utilities/types"
+)
+
+// Topic receives the events of every user, keyed by user id.
+const Topic types.Topic = "USER_NOTIFICATIONS"
+
+// Version is the version of the event schema, incremented on breaking changes.
+const Version = 1
+
+// Event types
+const (
+	OrderFilled          = "ORDER_FILLED"
+	OrderPartiallyFilled = "ORDER_PARTIALLY_FILLED"
+	OrderCancelled       = "ORDER_CANCELLED"
+	TradeExecuted        = "TRADE_EXECUTED"
+	TradeReversed        = "TRADE_REVERSED"
+	BalanceChanged       = "BALANCE_CHANGED"
+	PositionChanged      = "POSITION_CHANGED"
+)
+
+// Event is a user event, Data is one of the data types below depending on
+// the event type.
+type Event struct {
+	Version   int         `json:"version"`
+	ID        string      `json:"id"`
+	Type      string      `json:"type"`
+	UserID    string      `json:"userId"`
+	Nonce     int64       `json:"nonce"`
+	Data      interface{} `json:"data"`
+	CreatedAt time.Time   `json:"createdAt"`
+}
+
+// Order is the data of ORDER_* events.
+type Order struct {
+	OrderID        string `json:"orderId"`
+	InstrumentName string `json:"instrumentName"`
+	Side           string `json:"side"`
+	Status         string `json:"status"`
+	Price          string `json:"price"`
+	Amount         string `json:"amount"`
+	FilledAmount   string `json:"filledAmount"`
+}
+
+// Trade is the data of TRADE_* events.
+type Trade struct {
+	TradeID        string `json:"tradeId"`
+	OrderID        string `json:"orderId"`
+	InstrumentName string `json:"instrumentName"`
+	Side           string `json:"side"`
+	Role           string `json:"role"`
+	Price          string `json:"price"`
+	Amount         string `json:"amount"`
+	Fee            string `json:"fee"`
+}
+
+// Balance is the data of BALANCE_CHANGED events.
+type Balance struct {
+	Currency string `json:"currency"`
+	Amount   string `json:"amount"`
+}
+
+// Position is the data of POSITION_CHANGED events.
+type Position struct {
+	InstrumentName string `json:"instrumentName"`
+	Amount         string `json:"amount"`
+	AveragePrice   string `json:"averagePrice"`
+	RealizedPnl    string `json:"realizedPnl"`
+}
@@ -0,0 +1,16 @@
+package offset
+
+import "time"
+
+// Collection holds the last kafka offset processed by pickup for each topic
+// partition, recorded before the offset is committed.
+const Collection = "processed_offsets"
+
+// Processed is the last offset of the topic partition which was handled,
+// whether it saved an activity or was skipped.
+type Processed struct {
+	Topic     string    `json:"topic" bson:"topic"`
+	Partition int       `json:"partition" bson:"partition"`
+	Offset    int64     `json:"offset" bson:"offset"`
+	UpdatedAt time.Time `json:"updatedAt" bson:"updatedAt"`
+}
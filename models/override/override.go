@@ -0,0 +1,31 @@
+package override
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Collection holds the override of the system document, keyed by its id. It
+// is owned by pickup, so that overrides are read and written through the same
+// repository whatever the collection of the shared system document.
+const Collection = "engine_overrides"
+
+// Override forces the matching engine status regardless of nonce monitoring.
+type Override struct {
+	Status    string     `json:"status" bson:"status"`
+	Reason    string     `json:"reason" bson:"reason"`
+	Actor     string     `json:"actor" bson:"actor"`
+	ExpiresAt *time.Time `json:"expiresAt,omitempty" bson:"expiresAt,omitempty"`
+	CreatedAt time.Time  `json:"createdAt" bson:"createdAt"`
+}
+
+// Record is the override of the system document with the same id.
+type Record struct {
+	ID       primitive.ObjectID `json:"id" bson:"_id"`
+	Override *Override          `json:"override,omitempty" bson:"override,omitempty"`
+}
+
+func (o *Override) Expired() bool {
+	return o.ExpiresAt != nil && time.Now().After(*o.ExpiresAt)
+}
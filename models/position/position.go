@@ -0,0 +1,35 @@
+package position
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const Collection = "positions"
+
+// AppliedTradesLimit is the number of latest applied trade sides kept on the
+// position.
+const AppliedTradesLimit = 1000
+
+// Position is the contract position of a user on an instrument. The amount is
+// negative for short positions and the cost basis is the absolute amount
+// times the average price. The version is incremented on every update.
+//
+// Positions seeded from contracts held before positions were tracked have an
+// unknown cost: their average price and cost basis are zero and closing them
+// realizes no PnL, until they are closed or flipped.
+type Position struct {
+	ID             primitive.ObjectID `json:"id" bson:"_id"`
+	UserID         primitive.ObjectID `json:"userId" bson:"userId"`
+	InstrumentName string             `json:"instrumentName" bson:"instrumentName"`
+	Amount         string             `json:"amount" bson:"amount"`
+	AveragePrice   string             `json:"averagePrice" bson:"averagePrice"`
+	CostBasis      string             `json:"costBasis" bson:"costBasis"`
+	RealizedPnl    string             `json:"realizedPnl" bson:"realizedPnl"`
+	Fees           string             `json:"fees" bson:"fees"`
+	UnknownCost    bool               `json:"unknownCost,omitempty" bson:"unknownCost"`
+	AppliedTrades  []string           `json:"-" bson:"appliedTrades,omitempty"`
+	Version        int64              `json:"-" bson:"version"`
+	UpdatedAt      time.Time          `json:"updatedAt" bson:"updatedAt"`
+}
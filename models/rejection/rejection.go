@@ -0,0 +1,23 @@
+package rejection
+
+import (
+	"time"
+
+	"github.com/Undercurrent-Technologies/kprime-utilities/models/order"
+	"github.com/Undercurrent-Technologies/kprime-utilities/types"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const Collection = "rejected_orders"
+
+// SavedTopic receives the engine messages of rejected orders once saved.
+const SavedTopic types.Topic = "ORDER_REJECTED_SAVED"
+
+// Order is an order rejected by the matching engine, its id is the order id.
+type Order struct {
+	ID        primitive.ObjectID `json:"id" bson:"_id"`
+	Nonce     int64              `json:"nonce" bson:"nonce"`
+	Reason    string             `json:"reason" bson:"reason"`
+	Order     *order.Order       `json:"order" bson:"order"`
+	CreatedAt time.Time          `json:"createdAt" bson:"createdAt"`
+}
@@ -0,0 +1,32 @@
+package reservation
+
+import (
+	"time"
+
+	"github.com/Undercurrent-Technologies/kprime-utilities/types"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	OrderCollection   = "order_reservations"
+	BalanceCollection = "user_reservations"
+)
+
+// Order is the amount reserved by an open order, its id is the order id.
+type Order struct {
+	ID        primitive.ObjectID `json:"id" bson:"_id"`
+	UserID    primitive.ObjectID `json:"userId" bson:"userId"`
+	Currency  string             `json:"currency" bson:"currency"`
+	Amount    string             `json:"amount" bson:"amount"`
+	Status    types.OrderStatus  `json:"status" bson:"status"`
+	UpdatedAt time.Time          `json:"updatedAt" bson:"updatedAt"`
+}
+
+// Balance is the amount reserved by all open orders of a user in a currency.
+type Balance struct {
+	ID        primitive.ObjectID `json:"id" bson:"_id"`
+	UserID    primitive.ObjectID `json:"userId" bson:"userId"`
+	Currency  string             `json:"currency" bson:"currency"`
+	Reserved  string             `json:"reserved" bson:"reserved"`
+	UpdatedAt time.Time          `json:"updatedAt" bson:"updatedAt"`
+}
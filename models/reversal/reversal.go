@@ -0,0 +1,19 @@
+package reversal
+
+import (
+	"github.com/Undercurrent-Technologies/kprime-utilities/types"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Reversal is a trade side applied as successful and reversed once the trade
+// failed, recorded in the activity data under "reversals".
+type Reversal struct {
+	TradeID        primitive.ObjectID `json:"tradeId" bson:"tradeId"`
+	UserID         primitive.ObjectID `json:"userId" bson:"userId"`
+	Role           string             `json:"role" bson:"role"`
+	Side           types.Side         `json:"side" bson:"side"`
+	InstrumentName string             `json:"instrumentName" bson:"instrumentName"`
+	Amount         string             `json:"amount" bson:"amount"`
+	Price          string             `json:"price" bson:"price"`
+	Fee            string             `json:"fee" bson:"fee"`
+}
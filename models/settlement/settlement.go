@@ -0,0 +1,38 @@
+package settlement
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const Collection = "settlements"
+
+// Statuses of a settlement, entries without status were settled before
+// statuses existed.
+const (
+	StatusPending = "PENDING"
+	StatusSettled = "SETTLED"
+)
+
+// Settlement is the ledger entry of a contract cash-settled at expiry. Value
+// is the amount credited to the user, negative for short positions in the
+// money. The entry is pending until the contract has been removed from the
+// user collaterals, its value credited and the position closed. The sequence
+// numbers the settlements of the same user and instrument, from zero, a
+// contract being added again by a late trade after its settlement.
+type Settlement struct {
+	ID              primitive.ObjectID `json:"id" bson:"_id"`
+	UserID          primitive.ObjectID `json:"userId" bson:"userId"`
+	InstrumentName  string             `json:"instrumentName" bson:"instrumentName"`
+	Sequence        int                `json:"sequence" bson:"sequence"`
+	Currency        string             `json:"currency" bson:"currency"`
+	Amount          string             `json:"amount" bson:"amount"`
+	SettlementPrice string             `json:"settlementPrice" bson:"settlementPrice"`
+	Payoff          string             `json:"payoff" bson:"payoff"`
+	Value           string             `json:"value" bson:"value"`
+	Status          string             `json:"status" bson:"status"`
+	ExpiredAt       time.Time          `json:"expiredAt" bson:"expiredAt"`
+	CreatedAt       time.Time          `json:"createdAt" bson:"createdAt"`
+	SettledAt       *time.Time         `json:"settledAt,omitempty" bson:"settledAt,omitempty"`
+}
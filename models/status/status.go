@@ -0,0 +1,26 @@
+package status
+
+import (
+	"time"
+
+	"github.com/Undercurrent-Technologies/kprime-utilities/types"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const Collection = "engine_status_histories"
+
+// Topic receives every engine status change.
+const Topic types.Topic = "ENGINE_STATUS"
+
+// Change is an engine status transition. PublishedAt is set once the change
+// is published to the topic, changes without it were never delivered.
+type Change struct {
+	ID          primitive.ObjectID `json:"id" bson:"_id"`
+	OldStatus   string             `json:"oldStatus" bson:"oldStatus"`
+	NewStatus   string             `json:"newStatus" bson:"newStatus"`
+	EngineNonce int64              `json:"engineNonce" bson:"engineNonce"`
+	MongoNonce  int64              `json:"mongoNonce" bson:"mongoNonce"`
+	Reason      string             `json:"reason" bson:"reason"`
+	CreatedAt   time.Time          `json:"createdAt" bson:"createdAt"`
+	PublishedAt *time.Time         `json:"publishedAt,omitempty" bson:"publishedAt,omitempty"`
+}
@@ -0,0 +1,52 @@
+package stream
+
+import (
+	"time"
+
+	"github.com/Undercurrent-Technologies/kprime-utilities/models/order"
+	"github.com/Undercurrent-Technologies/kprime-utilities/models/trade"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Event types
+const (
+	ActivityEvent = "ACTIVITY"
+	TradeEvent    = "TRADE"
+	StatusEvent   = "STATUS"
+)
+
+// Activity is a saved activity as streamed, Data is kept as stored.
+type Activity struct {
+	ID          primitive.ObjectID `bson:"_id"`
+	Nonce       int64              `bson:"nonce"`
+	KafkaOffset int64              `bson:"kafkaOffset"`
+	Topic       string             `bson:"topic,omitempty"`
+	Data        bson.RawValue      `bson:"data"`
+	Hash        string             `bson:"hash,omitempty"`
+	CreatedAt   time.Time          `bson:"createdAt"`
+}
+
+// Event is a message of the stream. Nonce is the nonce of the activity which
+// saved the event and is zero for status changes. Data is only streamed to the
+// admin, the users of the event are streamed their view of it instead.
+type Event struct {
+	Type  string      `json:"type"`
+	Topic string      `json:"topic"`
+	Nonce int64       `json:"nonce,omitempty"`
+	Data  interface{} `json:"data"`
+
+	Users       []string               `json:"-"`
+	Instruments []string               `json:"-"`
+	Views       map[string]interface{} `json:"-"`
+}
+
+// UserActivity is the view of an activity streamed to one of its users: their
+// orders, their side of the trades and the mass-cancel query naming them.
+type UserActivity struct {
+	Nonce     int64          `json:"nonce"`
+	Orders    []*order.Order `json:"orders"`
+	Trades    []*trade.Trade `json:"trades"`
+	Query     interface{}    `json:"query,omitempty"`
+	CreatedAt time.Time      `json:"createdAt"`
+}
@@ -0,0 +1,40 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"pickup/datasources/mongo"
+	"pickup/migrations"
+	"pickup/service"
+
+	"github.com/Undercurrent-Technologies/kprime-utilities/commons/logs"
+)
+
+// Verify walks the whole activity hash chain, prints the report and exits
+// with a non-zero code when the chain is broken.
+func Verify() {
+	bootstrap()
+
+	cs := service.NewChainService(nil)
+	report, err := cs.Verify(nil, nil)
+	if err != nil {
+		logs.Log.Fatal().Err(err).Msg("Failed to verify activities!")
+	}
+
+	out, _ := json.MarshalIndent(report, "", "  ")
+	fmt.Println(string(out))
+
+	if report.Broken != nil {
+		os.Exit(1)
+	}
+}
+
+// Migrate applies the pending database migrations.
+func Migrate() {
+	bootstrap()
+
+	if err := migrations.Run(mongo.Database.DB()); err != nil {
+		logs.Log.Fatal().Err(err).Msg("Failed to migrate database!")
+	}
+}
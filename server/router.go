@@ -0,0 +1,32 @@
+package server
+
+import (
+	"net/http"
+	"pickup/api"
+	"pickup/datasources/kafka"
+	"pickup/service"
+
+	"github.com/Undercurrent-Technologies/kprime-utilities/repository/mongodb"
+)
+
+func newRouter(k *kafka.Kafka, r *mongodb.Repositories, js *service.JobService, st *service.StreamService) *http.ServeMux {
+	mux := http.NewServeMux()
+
+	// Activities
+	as := service.NewActivityService(r)
+	cs := service.NewChainService(k)
+	api.NewActivityHandler(as, cs).Register(mux)
+
+	// Users
+	us := service.NewUserService(r)
+	api.NewUserHandler(us).Register(mux)
+
+	// Admin
+	ads := service.NewAdminService(k, r, js)
+	api.NewAdminHandler(ads).Register(mux)
+
+	// Stream
+	api.NewStreamHandler(st).Register(mux)
+
+	return mux
+}
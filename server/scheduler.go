@@ -0,0 +1,115 @@
+package server
+
+import (
+	"pickup/app"
+	"pickup/service"
+	"strconv"
+	"time"
+
+	"github.com/Undercurrent-Technologies/kprime-utilities/commons/logs"
+)
+
+// startScheduler runs the system monitoring jobs every MonitoringInterval
+// milliseconds, a zero interval disables them. Nonce monitoring halts and
+// resumes the engine and gateway monitoring switches the gateway status read
+// by other services, they only run on schedule when enabled.
+func startScheduler(js *service.JobService) {
+	interval, err := strconv.Atoi(app.Config.Scheduler.MonitoringInterval)
+	if err != nil {
+		interval = 1000
+	}
+
+	if interval <= 0 {
+		return
+	}
+
+	nonce := service.NonceMonitoringScheduled()
+	gateway, _ := strconv.ParseBool(app.Config.Scheduler.GatewayMonitoring)
+	if !nonce && !gateway {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(time.Duration(interval) * time.Millisecond)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			if nonce {
+				js.NonceMonitoring()
+			}
+			if gateway {
+				js.GatewayMonitoring()
+			}
+		}
+	}()
+}
+
+// startCheckpoint publishes the activity chain checkpoint every
+// CheckpointInterval milliseconds, a zero interval disables it.
+func startCheckpoint(cs *service.ChainService) {
+	interval, err := strconv.Atoi(app.Config.Scheduler.CheckpointInterval)
+	if err != nil {
+		interval = 60000
+	}
+
+	if interval <= 0 {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(time.Duration(interval) * time.Millisecond)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			cs.Checkpoint()
+		}
+	}()
+}
+
+// startRetention archives old activities every ArchiveInterval milliseconds,
+// a zero interval disables it.
+func startRetention(rs *service.RetentionService) {
+	interval, err := strconv.Atoi(app.Config.Scheduler.ArchiveInterval)
+	if err != nil {
+		interval = 3600000
+	}
+
+	if interval <= 0 {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(time.Duration(interval) * time.Millisecond)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			if _, err := rs.Archive(); err != nil {
+				logs.Log.Error().Err(err).Msg("Failed to archive activities")
+			}
+		}
+	}()
+}
+
+// startSettlement settles expired options every SettlementInterval
+// milliseconds, a zero interval disables it.
+func startSettlement(ss *service.SettlementService) {
+	interval, err := strconv.Atoi(app.Config.Scheduler.SettlementInterval)
+	if err != nil {
+		interval = 60000
+	}
+
+	if interval <= 0 {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(time.Duration(interval) * time.Millisecond)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			if _, err := ss.Settle(); err != nil {
+				logs.Log.Error().Err(err).Msg("Failed to settle expired options")
+			}
+		}
+	}()
+}
@@ -8,7 +8,14 @@ import (
 	"pickup/datasources/collector"
 	"pickup/datasources/kafka"
 	"pickup/datasources/mongo"
+	"pickup/migrations"
+	"pickup/models/chain"
+	"pickup/models/instrument"
+	"pickup/models/notification"
+	"pickup/models/rejection"
+	"pickup/models/status"
 	"pickup/service"
+	"strconv"
 
 	"github.com/Undercurrent-Technologies/kprime-utilities/commons/metrics"
 	"github.com/Undercurrent-Technologies/kprime-utilities/types"
@@ -22,22 +29,20 @@ var topics = []types.Topic{
 	types.CANCELLED_ORDER,
 	types.ENGINE_SAVED,
 	types.CANCELLED_ORDER_SAVED,
+	status.Topic,
+	chain.CheckpointTopic,
+	rejection.SavedTopic,
+	notification.Topic,
 }
 
 func Start() {
-	// Initialize ENV
-	if err := app.LoadConfig(); err != nil {
-		logs.Log.Fatal().Err(err).Msg("Failed to load ENV!")
-	}
-
-	// Initialize Logger
-	if err := initLogger(); err != nil {
-		logs.Log.Fatal().Err(err).Msg("Failed to initialize logger")
-	}
+	bootstrap()
 
-	// Connect Database
-	if err := mongo.InitConnection(app.Config.Mongo.URL); err != nil {
-		logs.Log.Fatal().Err(err).Msg("Failed to connect database!")
+	// Migrate Database
+	if migrate, _ := strconv.ParseBool(app.Config.Mongo.MigrateOnStartup); migrate {
+		if err := migrations.Run(mongo.Database.DB()); err != nil {
+			logs.Log.Fatal().Err(err).Msg("Failed to migrate database!")
+		}
 	}
 
 	// Initialize Consumer
@@ -49,8 +54,15 @@ func Start() {
 	// Initialize MongoDB Repository
 	r := mongodb.NewRepositories(mongo.Database)
 
+	// Recover last applied state
+	report, err := service.Recover(k, r)
+	if err != nil {
+		logs.Log.Fatal().Err(err).Msg("Failed to recover state!")
+	}
+
 	// Initialize Service
-	ms := service.NewManagerService(k, r)
+	st := service.NewStreamService()
+	ms := service.NewManagerService(k, r, report.LastNonce, st)
 
 	// Subscribe to kafka
 	k.Subscribe(ms.HandlePickup)
@@ -58,15 +70,56 @@ func Start() {
 	// Close kafka connection
 	k.CloseConnection()
 
+	// Run system monitoring
+	js := service.NewJobService(k, r, &ms)
+	startScheduler(&js)
+
+	// Run activity checkpoints
+	cs := service.NewChainService(k)
+	startCheckpoint(&cs)
+
+	// Run activity retention
+	rs := service.NewRetentionService()
+	startRetention(&rs)
+
+	// Run option expiry settlement
+	ss := service.NewSettlementService()
+	startSettlement(&ss)
+
 	// Run server
 	serveMetric()
-	run()
+	run(newRouter(k, r, &js, st))
+}
+
+// bootstrap loads the configuration, initializes the logger and connects the database.
+func bootstrap() {
+	// Initialize ENV
+	if err := app.LoadConfig(); err != nil {
+		logs.Log.Fatal().Err(err).Msg("Failed to load ENV!")
+	}
+
+	// Initialize Logger
+	if err := initLogger(); err != nil {
+		logs.Log.Fatal().Err(err).Msg("Failed to initialize logger")
+	}
+
+	// Initialize instrument expiry
+	hour, err := strconv.Atoi(app.Config.Instrument.ExpiryHour)
+	if err != nil || hour < 0 || hour > 23 {
+		logs.Log.Fatal().Str("value", app.Config.Instrument.ExpiryHour).Msg("Invalid INSTRUMENT_EXPIRY_HOUR!")
+	}
+	instrument.ExpiryHour = hour
+
+	// Connect Database
+	if err := mongo.InitConnection(app.Config.Mongo.URL); err != nil {
+		logs.Log.Fatal().Err(err).Msg("Failed to connect database!")
+	}
 }
 
-func run() {
+func run(handler http.Handler) {
 	port := fmt.Sprintf(":%v", app.Config.HTTP.ServerPort)
 	log.Printf("Server %v is running on localhost:%v\n", app.Version, app.Config.HTTP.ServerPort)
-	err := http.ListenAndServe(port, nil)
+	err := http.ListenAndServe(port, handler)
 	if err != nil {
 		logs.Log.Fatal().Err(err).Msg(fmt.Sprintf("Failed to listen and serve on port %s", app.Config.HTTP.ServerPort))
 	}
@@ -79,6 +132,13 @@ func serveMetric() {
 			collector.IncomingCounter,
 			collector.SuccessCounter,
 			collector.RequestDurationHistogram,
+			collector.EngineStatusGauge,
+			collector.GatewayStatusGauge,
+			collector.EngineOverrideGauge,
+			collector.CollateralConflictCounter,
+			collector.RejectedInstrumentCounter,
+			collector.IllegalTransitionCounter,
+			collector.CancelDiscrepancyCounter,
 		)
 
 		if err := m.Serve(); err != nil {
@@ -0,0 +1,81 @@
+package service
+
+import (
+	"github.com/Undercurrent-Technologies/kprime-utilities/interfaces"
+	"github.com/Undercurrent-Technologies/kprime-utilities/models/activity"
+	"github.com/Undercurrent-Technologies/kprime-utilities/repository/mongodb"
+	"github.com/Undercurrent-Technologies/kprime-utilities/types"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// legacyTopic derives the source topic of an activity stored without it from
+// the shape of its data: only cancelled order activities carry a query.
+func legacyTopic(data bson.Raw) string {
+	if _, err := data.LookupErr("data", "query"); err == nil {
+		return types.CANCELLED_ORDER.String()
+	}
+
+	return types.ENGINE.String()
+}
+
+type ActivityFilter struct {
+	Topic       string
+	Nonce       *int64
+	FromNonce   *int64
+	ToNonce     *int64
+	KafkaOffset *int64
+	Page        int64
+	Limit       int64
+}
+
+type ActivityService struct {
+	activity interfaces.Repository[activity.Activity]
+}
+
+func NewActivityService(r *mongodb.Repositories) ActivityService {
+	return ActivityService{activity: r.Activity}
+}
+
+func (as *ActivityService) FindByID(id primitive.ObjectID) *activity.Activity {
+	return as.activity.FindOne(bson.M{"_id": id})
+}
+
+func (as *ActivityService) FindByNonce(nonce int64) *activity.Activity {
+	return as.activity.FindOne(bson.M{"nonce": nonce})
+}
+
+// Find returns the page of activities matching the filter, with one extra
+// activity when another page exists.
+func (as *ActivityService) Find(f ActivityFilter) ([]activity.Activity, error) {
+	match := bson.M{}
+	if f.Topic != "" {
+		match["topic"] = f.Topic
+	}
+
+	if f.Nonce != nil {
+		match["nonce"] = *f.Nonce
+	} else if f.FromNonce != nil || f.ToNonce != nil {
+		nonce := bson.M{}
+		if f.FromNonce != nil {
+			nonce["$gte"] = *f.FromNonce
+		}
+		if f.ToNonce != nil {
+			nonce["$lte"] = *f.ToNonce
+		}
+		match["nonce"] = nonce
+	}
+
+	if f.KafkaOffset != nil {
+		match["kafkaOffset"] = *f.KafkaOffset
+	}
+
+	pipeline := []bson.M{
+		{"$match": match},
+		{"$sort": bson.M{"nonce": 1}},
+		{"$skip": (f.Page - 1) * f.Limit},
+		{"$limit": f.Limit + 1},
+	}
+
+	return as.activity.Aggregate(pipeline)
+}
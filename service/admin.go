@@ -0,0 +1,261 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"pickup/datasources/kafka"
+	"pickup/datasources/mongo"
+	"pickup/models/audit"
+	"pickup/models/fee"
+	"pickup/models/override"
+	"pickup/models/status"
+	"time"
+
+	"github.com/Undercurrent-Technologies/kprime-utilities/commons/logs"
+	"github.com/Undercurrent-Technologies/kprime-utilities/models/system"
+	"github.com/Undercurrent-Technologies/kprime-utilities/repository/mongodb"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var (
+	ErrActivityNotFound = errors.New("ActivityNotFound")
+	// ErrOverrideExpiryDisabled rejects overrides with a duration while
+	// nonce monitoring does not run on schedule, nothing would give control
+	// back to it once the override expires.
+	ErrOverrideExpiryDisabled = errors.New("OverrideExpiryDisabled")
+)
+
+type EngineState struct {
+	Status   system.Status      `json:"status"`
+	Override *override.Override `json:"override,omitempty"`
+}
+
+// Actor is the operator of an admin action. The name is declared by the
+// caller, the fingerprint of the API key and the remote address tell where
+// the action actually came from.
+type Actor struct {
+	Name           string
+	KeyFingerprint string
+	RemoteAddr     string
+}
+
+type AdminService struct {
+	kafkaConn  *kafka.Kafka
+	activity   ActivityService
+	job        *JobService
+	override   OverrideService
+	retention  RetentionService
+	settlement SettlementService
+	fee        FeeService
+	audit      *mongo.Repository[audit.Audit]
+}
+
+func NewAdminService(k *kafka.Kafka, r *mongodb.Repositories, js *JobService) AdminService {
+	return AdminService{
+		kafkaConn:  k,
+		activity:   NewActivityService(r),
+		job:        js,
+		override:   NewOverrideService(r),
+		retention:  NewRetentionService(),
+		settlement: NewSettlementService(),
+		fee:        NewFeeService(),
+		audit:      mongo.NewRepository[audit.Audit](mongo.Database, audit.Collection),
+	}
+}
+
+func (as *AdminService) Consumers() []kafka.ConsumerStatus {
+	return as.kafkaConn.Consumers()
+}
+
+func (as *AdminService) Pause(actor Actor, topic string) error {
+	err := as.kafkaConn.Pause(topic)
+	as.record(actor, "PAUSE_CONSUMER", map[string]interface{}{"topic": topic}, err)
+
+	return err
+}
+
+func (as *AdminService) Resume(actor Actor, topic string) error {
+	err := as.kafkaConn.Resume(topic)
+	as.record(actor, "RESUME_CONSUMER", map[string]interface{}{"topic": topic}, err)
+
+	return err
+}
+
+func (as *AdminService) Seek(actor Actor, topic string, partition int, offset int64) error {
+	err := as.kafkaConn.Seek(topic, partition, offset)
+	params := map[string]interface{}{"topic": topic, "partition": partition, "offset": offset}
+	as.record(actor, "SEEK_CONSUMER", params, err)
+
+	return err
+}
+
+// SeekNonce seeks the partition to the kafka offset recorded for the nonce,
+// so the message of that nonce is consumed again.
+func (as *AdminService) SeekNonce(actor Actor, topic string, partition int, nonce int64) error {
+	params := map[string]interface{}{"topic": topic, "partition": partition, "nonce": nonce}
+
+	offset, err := as.findOffset(topic, nonce)
+	if err == nil {
+		params["offset"] = offset
+		err = as.kafkaConn.Seek(topic, partition, offset)
+	}
+
+	as.record(actor, "SEEK_CONSUMER_NONCE", params, err)
+
+	return err
+}
+
+// findOffset returns the kafka offset recorded for the nonce, looking into
+// the archive index when the activity has been archived.
+func (as *AdminService) findOffset(topic string, nonce int64) (int64, error) {
+	acts, err := as.activity.Find(ActivityFilter{Topic: topic, Nonce: &nonce, Page: 1, Limit: 1})
+	if err != nil {
+		return 0, err
+	}
+
+	if len(acts) > 0 {
+		return acts[0].KafkaOffset, nil
+	}
+
+	if idx := as.retention.FindIndex(nonce); idx != nil && idx.Topic == topic {
+		return idx.KafkaOffset, nil
+	}
+
+	return 0, ErrActivityNotFound
+}
+
+func (as *AdminService) ArchiveActivities(actor Actor) (int, error) {
+	total, err := as.retention.Archive()
+	as.record(actor, "ARCHIVE_ACTIVITIES", map[string]interface{}{"total": total}, err)
+
+	return total, err
+}
+
+func (as *AdminService) RestoreActivities(actor Actor, from, to int64) (int, error) {
+	total, err := as.retention.Restore(from, to)
+	params := map[string]interface{}{"fromNonce": from, "toNonce": to, "total": total}
+	as.record(actor, "RESTORE_ACTIVITIES", params, err)
+
+	return total, err
+}
+
+func (as *AdminService) RunNonceMonitoring(actor Actor) {
+	as.job.NonceMonitoring()
+	as.record(actor, "RUN_NONCE_MONITORING", map[string]interface{}{}, nil)
+}
+
+func (as *AdminService) RunSettlement(actor Actor) (int, error) {
+	total, err := as.settlement.Settle()
+	as.record(actor, "RUN_SETTLEMENT", map[string]interface{}{"total": total}, err)
+
+	return total, err
+}
+
+func (as *AdminService) FindFeeAccounts() ([]fee.Account, error) {
+	return as.fee.FindAccounts()
+}
+
+func (as *AdminService) FeeReport(group string, from, to *time.Time) ([]FeeReport, error) {
+	return as.fee.Report(group, from, to)
+}
+
+// CheckFees verifies the fee accounting and alerts about inconsistencies.
+func (as *AdminService) CheckFees(from, to *time.Time) ([]FeeConsistency, error) {
+	res, err := as.fee.Check(from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, c := range res {
+		if !c.Consistent {
+			logs.Log.Error().Any("fees", c).Msg("Inconsistent fees")
+			alert(fmt.Sprintf("Inconsistent %s fees, trades: %s, ledger: %s, account: %s", c.Currency, c.Trades, c.Ledger, c.Account))
+		}
+	}
+
+	return res, nil
+}
+
+func (as *AdminService) Engine() (*EngineState, error) {
+	s := findSystem(as.job.system)
+	if s == nil {
+		return nil, ErrSystemNotFound
+	}
+
+	return &EngineState{Status: s.Status, Override: as.override.Find(s)}, nil
+}
+
+// OverrideEngine forces the engine status until the override is cleared or,
+// when ttl is positive, until it expires, which requires scheduled nonce
+// monitoring. The override is applied right away.
+func (as *AdminService) OverrideEngine(actor Actor, status, reason string, ttl time.Duration) error {
+	if ttl > 0 && !NonceMonitoringScheduled() {
+		return ErrOverrideExpiryDisabled
+	}
+
+	now := time.Now()
+	o := &override.Override{Status: status, Reason: reason, Actor: actor.Name, CreatedAt: now}
+	if ttl > 0 {
+		expiresAt := now.Add(ttl)
+		o.ExpiresAt = &expiresAt
+	}
+
+	err := as.override.Set(o)
+	params := map[string]interface{}{"status": status, "reason": reason, "ttl": ttl.String()}
+	as.record(actor, "OVERRIDE_ENGINE", params, err)
+	if err != nil {
+		return err
+	}
+
+	as.job.NonceMonitoring()
+
+	return nil
+}
+
+// ClearEngineOverride gives the engine status control back to nonce monitoring.
+func (as *AdminService) ClearEngineOverride(actor Actor) error {
+	err := as.override.Clear()
+	as.record(actor, "CLEAR_ENGINE_OVERRIDE", map[string]interface{}{}, err)
+	if err != nil {
+		return err
+	}
+
+	as.job.NonceMonitoring()
+
+	return nil
+}
+
+func (as *AdminService) FindEngineHistory(page, limit int64) ([]status.Change, error) {
+	return as.job.notifier.FindHistory(page, limit)
+}
+
+func (as *AdminService) FindAudits(page, limit int64) ([]audit.Audit, error) {
+	opts := options.Find().
+		SetSort(bson.M{"createdAt": -1}).
+		SetSkip((page - 1) * limit).
+		SetLimit(limit)
+
+	return as.audit.Find(bson.M{}, opts)
+}
+
+func (as *AdminService) record(actor Actor, action string, params map[string]interface{}, err error) {
+	a := &audit.Audit{
+		ID:             primitive.NewObjectID(),
+		Actor:          actor.Name,
+		KeyFingerprint: actor.KeyFingerprint,
+		RemoteAddr:     actor.RemoteAddr,
+		Action:         action,
+		Params:         params,
+		CreatedAt:      time.Now(),
+	}
+
+	if err != nil {
+		a.Error = err.Error()
+	}
+
+	if e := as.audit.Create(a); e != nil {
+		logger.Errorf("Failed to record audit %s: %v", action, e)
+	}
+}
@@ -0,0 +1,156 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"pickup/datasources/collector"
+	"strings"
+
+	"github.com/Undercurrent-Technologies/kprime-utilities/commons/logs"
+	"github.com/Undercurrent-Technologies/kprime-utilities/models/order"
+	"github.com/Undercurrent-Technologies/kprime-utilities/types"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// CancelQuery is the mass-cancel query of a cancelled order message, cancelling
+// the open orders of a user, an instrument, a side or all of them.
+type CancelQuery struct {
+	UserID         string `json:"userId"`
+	InstrumentName string `json:"instrumentName"`
+	Side           string `json:"side"`
+	All            bool   `json:"all"`
+}
+
+// CancelDiscrepancies are the open orders matching the query missing from
+// the cancelled orders, and the cancelled orders not matching the query.
+type CancelDiscrepancies struct {
+	Missing    []primitive.ObjectID `json:"missing" bson:"missing"`
+	Unexpected []primitive.ObjectID `json:"unexpected" bson:"unexpected"`
+}
+
+// parseCancelQuery returns nil when the query does not select orders, i.e.
+// only the cancelled orders of the message are cancelled, or selects every
+// open order of the exchange, which is not verified to avoid scanning them
+// all. A query which cannot be read or selects nothing is logged, since its
+// cancelled orders are then not verified. All only marks the query as
+// selecting orders, the user, instrument and side still narrow it.
+func parseCancelQuery(q interface{}) *CancelQuery {
+	if q == nil {
+		return nil
+	}
+
+	v, err := json.Marshal(q)
+	if err != nil {
+		logs.Log.Warn().Err(err).Any("query", q).Msg("Failed to read cancel query")
+		return nil
+	}
+
+	cq := &CancelQuery{}
+	if err := json.Unmarshal(v, cq); err != nil {
+		logs.Log.Warn().Err(err).Str("query", string(v)).Msg("Failed to read cancel query")
+		return nil
+	}
+
+	if cq.UserID == "" && cq.InstrumentName == "" && cq.Side == "" {
+		if cq.All {
+			logs.Log.Info().Str("query", string(v)).Msg("Cancel query selects every order, cancelled orders are not verified")
+			return nil
+		}
+
+		logs.Log.Warn().Str("query", string(v)).Msg("Cancel query selects no orders, cancelled orders are not verified")
+		return nil
+	}
+
+	return cq
+}
+
+func (cq *CancelQuery) match(o *order.Order) bool {
+	if cq.UserID != "" && o.UserID.Hex() != cq.UserID {
+		return false
+	}
+
+	if cq.InstrumentName != "" && o.OrderCode() != cq.InstrumentName {
+		return false
+	}
+
+	if cq.Side != "" && !strings.EqualFold(o.Side.String(), cq.Side) {
+		return false
+	}
+
+	return true
+}
+
+// filter selects the open orders of the query, the instrument is matched on
+// the decoded orders.
+func (cq *CancelQuery) filter() (bson.M, error) {
+	f := bson.M{"status": bson.M{"$in": []types.OrderStatus{types.OPEN, types.PARTIAL_FILLED}}}
+	if cq.UserID != "" {
+		id, err := primitive.ObjectIDFromHex(cq.UserID)
+		if err != nil {
+			return nil, err
+		}
+		f["userId"] = id
+	}
+
+	if cq.InstrumentName != "" {
+		for k, v := range instrumentFilter(cq.InstrumentName) {
+			f[k] = v
+		}
+	}
+
+	if cq.Side != "" {
+		f["side"] = types.Side(strings.ToUpper(cq.Side))
+	}
+
+	return f, nil
+}
+
+// verifyCancel compares the cancelled orders with the open orders matching
+// the query and flags the discrepancies. It runs before the cancelled orders
+// are persisted.
+func (m *ManagerService) verifyCancel(cq *CancelQuery, cancelled []*order.Order, nonce int64) *CancelDiscrepancies {
+	f, err := cq.filter()
+	if err != nil {
+		logs.Log.Error().Err(err).Int64("nonce", nonce).Msg("Invalid cancel query")
+		return nil
+	}
+
+	open, err := m.repositories.Order.Aggregate([]bson.M{{"$match": f}})
+	if err != nil {
+		logs.Log.Error().Err(err).Int64("nonce", nonce).Msg("Failed to find orders of cancel query")
+		return nil
+	}
+
+	ids := map[primitive.ObjectID]bool{}
+	for _, o := range cancelled {
+		ids[o.ID] = true
+	}
+
+	d := &CancelDiscrepancies{Missing: []primitive.ObjectID{}, Unexpected: []primitive.ObjectID{}}
+	for i := range open {
+		if cq.match(&open[i]) && !ids[open[i].ID] {
+			d.Missing = append(d.Missing, open[i].ID)
+		}
+	}
+
+	for _, o := range cancelled {
+		if !cq.match(o) {
+			d.Unexpected = append(d.Unexpected, o.ID)
+		}
+	}
+
+	if len(d.Missing) == 0 && len(d.Unexpected) == 0 {
+		return nil
+	}
+
+	collector.CancelDiscrepancyCounter.WithLabelValues("missing").Add(float64(len(d.Missing)))
+	collector.CancelDiscrepancyCounter.WithLabelValues("unexpected").Add(float64(len(d.Unexpected)))
+	logs.Log.Error().Int64("nonce", nonce).Any("query", cq).Any("discrepancies", d).Msg("Cancelled orders do not match the cancel query")
+	alert(fmt.Sprintf(
+		"Cancelled orders of nonce %d do not match the cancel query, missing: %d, unexpected: %d",
+		nonce, len(d.Missing), len(d.Unexpected),
+	))
+
+	return d
+}
@@ -0,0 +1,54 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/Undercurrent-Technologies/kprime-utilities/models/order"
+	"github.com/Undercurrent-Technologies/kprime-utilities/types"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestParseCancelQuery(t *testing.T) {
+	tests := []struct {
+		name  string
+		query interface{}
+		want  bool
+	}{
+		{"no query", nil, false},
+		{"empty query", map[string]interface{}{}, false},
+		{"exchange-wide", map[string]interface{}{"all": true}, false},
+		{"all orders of a user", map[string]interface{}{"all": true, "userId": primitive.NewObjectID().Hex()}, true},
+		{"side", map[string]interface{}{"side": "BUY"}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parseCancelQuery(tt.query) != nil; got != tt.want {
+				t.Errorf("parseCancelQuery() != nil = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCancelQueryMatch(t *testing.T) {
+	user, other := primitive.NewObjectID(), primitive.NewObjectID()
+	tests := []struct {
+		name  string
+		query CancelQuery
+		order order.Order
+		want  bool
+	}{
+		{"all orders of the user", CancelQuery{All: true, UserID: user.Hex()}, order.Order{UserID: user, Side: types.BUY}, true},
+		{"all orders of another user", CancelQuery{All: true, UserID: user.Hex()}, order.Order{UserID: other, Side: types.BUY}, false},
+		{"all orders of the side", CancelQuery{All: true, Side: "sell"}, order.Order{UserID: user, Side: types.BUY}, false},
+		{"side of the user", CancelQuery{UserID: user.Hex(), Side: "buy"}, order.Order{UserID: user, Side: types.BUY}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.query.match(&tt.order); got != tt.want {
+				t.Errorf("match() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
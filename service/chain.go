@@ -0,0 +1,207 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"pickup/datasources/kafka"
+	"pickup/datasources/mongo"
+	"pickup/models/archive"
+	"pickup/models/chain"
+	"time"
+
+	"github.com/Undercurrent-Technologies/kprime-utilities/commons/logs"
+	"github.com/Undercurrent-Technologies/kprime-utilities/models/activity"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	kafkago "github.com/segmentio/kafka-go"
+)
+
+type BrokenLink struct {
+	Nonce  int64  `json:"nonce"`
+	Reason string `json:"reason"`
+}
+
+type ChainReport struct {
+	Verified   int64       `json:"verified"`
+	Unchained  int64       `json:"unchained"`
+	OutOfOrder []int64     `json:"outOfOrder,omitempty"`
+	LastNonce  int64       `json:"lastNonce"`
+	LastHash   string      `json:"lastHash"`
+	Broken     *BrokenLink `json:"broken,omitempty"`
+}
+
+// ChainService maintains a hash chain over activities ordered by nonce.
+type ChainService struct {
+	kafkaConn      *kafka.Kafka
+	links          *mongo.Repository[chain.Link]
+	index          *mongo.Repository[archive.Index]
+	lastCheckpoint *int64
+}
+
+func NewChainService(k *kafka.Kafka) ChainService {
+	return ChainService{
+		kafkaConn:      k,
+		links:          mongo.NewRepository[chain.Link](mongo.Database, chain.Collection),
+		index:          mongo.NewRepository[archive.Index](mongo.Database, archive.IndexCollection),
+		lastCheckpoint: new(int64),
+	}
+}
+
+// Link chains the activity to the in order activity with the previous nonce.
+// The activity data is replaced by its BSON encoding, so the stored data is
+// exactly what has been hashed. An activity following a higher nonce is
+// flagged as out of order, existing links are never rewritten.
+func (cs *ChainService) Link(a *activity.Activity) (*chain.Activity, error) {
+	t, v, err := bson.MarshalValue(a.Data)
+	if err != nil {
+		return nil, err
+	}
+
+	data := bson.RawValue{Type: t, Value: v}
+	a.Data = data
+
+	l := &chain.Link{Nonce: a.Nonce, KafkaOffset: a.KafkaOffset, Data: data}
+	l.PrevHash = cs.previousHash(a.Nonce)
+
+	c := &chain.Activity{Activity: *a, Hash: l.ComputeHash(), PrevHash: l.PrevHash}
+	if cs.links.FindOne(bson.M{"nonce": bson.M{"$gt": a.Nonce}, "hash": bson.M{"$exists": true}}) != nil {
+		c.OutOfOrder = true
+		logs.Log.Warn().Int64("nonce", a.Nonce).Msg("Activity chained out of order")
+		alert(fmt.Sprintf("Activity with nonce %d was inserted after a higher nonce and chained out of order", a.Nonce))
+	}
+
+	return c, nil
+}
+
+// Verify walks the chain between the nonces and reports the first broken link.
+// Activities inserted before the chain existed are counted as unchained.
+func (cs *ChainService) Verify(from, to *int64) (*ChainReport, error) {
+	filter := bson.M{}
+	nonce := bson.M{}
+	if from != nil {
+		nonce["$gte"] = *from
+	}
+	if to != nil {
+		nonce["$lte"] = *to
+	}
+	if len(nonce) > 0 {
+		filter["nonce"] = nonce
+	}
+
+	report := &ChainReport{}
+	expected := ""
+	started := false
+	if from != nil {
+		if expected = cs.previousHash(*from); expected != "" {
+			started = true
+		}
+	}
+
+	opts := options.Find().SetSort(bson.M{"nonce": 1})
+	cursor, err := cs.links.Collection().Find(context.Background(), filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(context.Background())
+
+	for cursor.Next(context.Background()) {
+		l := chain.Link{}
+		if err := cursor.Decode(&l); err != nil {
+			return nil, err
+		}
+
+		if l.Hash == "" && !started {
+			report.Unchained++
+			continue
+		}
+
+		if !started {
+			expected = cs.previousHash(l.Nonce)
+			started = true
+		}
+
+		if report.Broken = checkLink(&l, expected); report.Broken != nil {
+			return report, nil
+		}
+
+		// Out of order links are side entries, the chain goes on from the
+		// previous in order link
+		if l.OutOfOrder {
+			report.OutOfOrder = append(report.OutOfOrder, l.Nonce)
+			continue
+		}
+
+		expected = l.Hash
+		report.Verified++
+		report.LastNonce = l.Nonce
+		report.LastHash = l.Hash
+	}
+
+	return report, cursor.Err()
+}
+
+// checkLink returns the reason why the link does not follow the expected
+// previous hash, nil when it does.
+func checkLink(l *chain.Link, expected string) *BrokenLink {
+	switch {
+	case l.Hash == "":
+		return &BrokenLink{Nonce: l.Nonce, Reason: "MissingHash"}
+	case l.PrevHash != expected:
+		return &BrokenLink{Nonce: l.Nonce, Reason: "PrevHashMismatch"}
+	case l.ComputeHash() != l.Hash:
+		return &BrokenLink{Nonce: l.Nonce, Reason: "HashMismatch"}
+	}
+
+	return nil
+}
+
+// Checkpoint publishes the latest hash of the chain when it changed since
+// the previous checkpoint.
+func (cs *ChainService) Checkpoint() {
+	opts := options.FindOne().SetSort(bson.M{"nonce": -1})
+	l := cs.links.FindOne(bson.M{"hash": bson.M{"$exists": true}, "outOfOrder": bson.M{"$ne": true}}, opts)
+	if l == nil || l.Nonce == *cs.lastCheckpoint {
+		return
+	}
+
+	c := chain.Checkpoint{Nonce: l.Nonce, Hash: l.Hash, CreatedAt: time.Now()}
+	v, err := json.Marshal(c)
+	if err != nil {
+		return
+	}
+
+	msg := kafkago.Message{Topic: chain.CheckpointTopic.String(), Value: v}
+	if err := cs.kafkaConn.Publish(msg); err != nil {
+		logs.Log.Error().Err(err).Msg("Failed to publish activity checkpoint")
+		return
+	}
+
+	*cs.lastCheckpoint = l.Nonce
+	logs.Log.Info().Any("checkpoint", c).Msg("Activity checkpoint published")
+}
+
+// previousHash returns the hash of the in order activity preceding the nonce,
+// which may have been archived.
+func (cs *ChainService) previousHash(nonce int64) string {
+	prev := cs.previous(nonce)
+
+	opts := options.FindOne().SetSort(bson.M{"nonce": -1})
+	idx := cs.index.FindOne(bson.M{"nonce": bson.M{"$lt": nonce}, "outOfOrder": bson.M{"$ne": true}}, opts)
+	if idx != nil && (prev == nil || idx.Nonce > prev.Nonce) {
+		return idx.Hash
+	}
+
+	if prev != nil {
+		return prev.Hash
+	}
+
+	return ""
+}
+
+// previous returns the in order link preceding the nonce.
+func (cs *ChainService) previous(nonce int64) *chain.Link {
+	opts := options.FindOne().SetSort(bson.M{"nonce": -1})
+	return cs.links.FindOne(bson.M{"nonce": bson.M{"$lt": nonce}, "outOfOrder": bson.M{"$ne": true}}, opts)
+}
@@ -0,0 +1,84 @@
+package service
+
+import (
+	"pickup/models/chain"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func newLink(t *testing.T, nonce int64, prev string, data interface{}) chain.Link {
+	t.Helper()
+
+	typ, v, err := bson.MarshalValue(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	l := chain.Link{Nonce: nonce, KafkaOffset: nonce * 10, Data: bson.RawValue{Type: typ, Value: v}, PrevHash: prev}
+	l.Hash = l.ComputeHash()
+
+	return l
+}
+
+func TestLinkComputeHash(t *testing.T) {
+	l := newLink(t, 1, "", bson.M{"trades": bson.A{}})
+	if l.ComputeHash() != l.Hash {
+		t.Fatal("hash is not deterministic")
+	}
+
+	changes := map[string]func(l *chain.Link){
+		"nonce":       func(l *chain.Link) { l.Nonce++ },
+		"kafkaOffset": func(l *chain.Link) { l.KafkaOffset++ },
+		"prevHash":    func(l *chain.Link) { l.PrevHash = "00" },
+		"data":        func(l *chain.Link) { l.Data.Value = append([]byte{}, l.Data.Value[:len(l.Data.Value)-1]...) },
+		"dataType":    func(l *chain.Link) { l.Data.Type = bson.TypeArray },
+	}
+
+	for name, change := range changes {
+		t.Run(name, func(t *testing.T) {
+			c := l
+			change(&c)
+			if c.ComputeHash() == l.Hash {
+				t.Errorf("hash does not cover %s", name)
+			}
+		})
+	}
+}
+
+func TestCheckLink(t *testing.T) {
+	first := newLink(t, 1, "", bson.M{"n": 1})
+	second := newLink(t, 2, first.Hash, bson.M{"n": 2})
+
+	tampered := second
+	tampered.Data = newLink(t, 2, first.Hash, bson.M{"n": 3}).Data
+
+	unhashed := second
+	unhashed.Hash = ""
+
+	tests := []struct {
+		name     string
+		link     chain.Link
+		expected string
+		want     string
+	}{
+		{"first link", first, "", ""},
+		{"following link", second, first.Hash, ""},
+		{"missing hash", unhashed, first.Hash, "MissingHash"},
+		{"wrong previous hash", second, "", "PrevHashMismatch"},
+		{"tampered data", tampered, first.Hash, "HashMismatch"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ""
+			if b := checkLink(&tt.link, tt.expected); b != nil {
+				got = b.Reason
+			}
+
+			if got != tt.want {
+				t.Errorf("checkLink() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
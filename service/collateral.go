@@ -0,0 +1,162 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"pickup/app"
+	"pickup/datasources/collector"
+	"pickup/datasources/mongo"
+	"pickup/models/collateral"
+
+	"github.com/Undercurrent-Technologies/kprime-utilities/commons/logs"
+	"github.com/Undercurrent-Technologies/kprime-utilities/models/user"
+	"github.com/shopspring/decimal"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// collateralCurrency is the currency of the premiums and fees.
+const collateralCurrency = "USD"
+
+var (
+	ErrUserNotFound       = errors.New("UserNotFound")
+	ErrCollateralConflict = errors.New("CollateralConflict")
+)
+
+// CollateralService updates user collaterals with a compare-and-swap on the
+// stored collaterals, so that concurrent changes by other services, e.g.
+// deposits from the gateway, are never overwritten.
+type CollateralService struct {
+	users   *mongo.Repository[collateral.User]
+	retries int
+}
+
+func NewCollateralService() CollateralService {
+	return CollateralService{
+		users:   mongo.NewRepository[collateral.User](mongo.Database, collateral.Collection),
+		retries: parseInt(app.Config.Collateral.Retries, 5),
+	}
+}
+
+// Update applies fn to the current collaterals of the user, reading them again
+// and retrying when they were changed in between. Nothing is written when fn
+// returns false.
+func (cs *CollateralService) Update(userID primitive.ObjectID, fn func(c *user.Collaterals) bool) error {
+	_, err := cs.update(userID, "", fn)
+	return err
+}
+
+// Apply applies fn like Update unless the key, e.g. a trade side, was already
+// applied, and records the key with the collaterals in the same write.
+// Returns whether fn was applied.
+func (cs *CollateralService) Apply(userID primitive.ObjectID, key string, fn func(c *user.Collaterals) bool) (bool, error) {
+	return cs.update(userID, key, fn)
+}
+
+func (cs *CollateralService) update(userID primitive.ObjectID, key string, fn func(c *user.Collaterals) bool) (bool, error) {
+	for attempt := 0; attempt <= cs.retries; attempt++ {
+		u := cs.users.FindOne(bson.M{"_id": userID})
+		if u == nil {
+			return false, ErrUserNotFound
+		}
+
+		if key != "" && contains(u.AppliedTrades, key) {
+			return false, nil
+		}
+
+		c := user.Collaterals{}
+		var old interface{}
+		if u.Collaterals.Type != 0 {
+			old = u.Collaterals
+			if err := u.Collaterals.Unmarshal(&c); err != nil {
+				return false, err
+			}
+		}
+
+		if !fn(&c) {
+			return false, nil
+		}
+
+		filter := bson.M{"_id": userID, "collaterals": old}
+		update := bson.M{"$set": bson.M{"collaterals": c}, "$inc": bson.M{"version": 1}}
+		if key != "" {
+			filter["appliedTrades"] = bson.M{"$ne": key}
+			update["$push"] = bson.M{"appliedTrades": bson.M{"$each": bson.A{key}, "$slice": -collateral.AppliedTradesLimit}}
+		}
+
+		ok, err := cs.users.Update(filter, update)
+		if err != nil {
+			return false, err
+		}
+
+		if ok {
+			return true, nil
+		}
+
+		collector.CollateralConflictCounter.WithLabelValues("retried").Inc()
+		logs.Log.Warn().Any("userId", userID).Int("attempt", attempt+1).Msg("Collateral conflict")
+	}
+
+	collector.CollateralConflictCounter.WithLabelValues("exhausted").Inc()
+
+	return false, ErrCollateralConflict
+}
+
+// FindContract returns the contract amount of the user on the instrument, nil
+// when the user holds none.
+func (cs *CollateralService) FindContract(userID primitive.ObjectID, instrument string) (*decimal.Decimal, error) {
+	u := cs.users.FindOne(bson.M{"_id": userID})
+	if u == nil {
+		return nil, ErrUserNotFound
+	}
+
+	c := user.Collaterals{}
+	if u.Collaterals.Type != 0 {
+		if err := u.Collaterals.Unmarshal(&c); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, con := range c.Contracts {
+		if con.InstrumentName == instrument {
+			a := con.GetAmount()
+			return &a, nil
+		}
+	}
+
+	return nil, nil
+}
+
+// FindInstruments returns the instrument names of all contracts held by users.
+func (cs *CollateralService) FindInstruments() ([]string, error) {
+	res, err := cs.users.Collection().Distinct(context.Background(), "collaterals.contracts.instrumentName", bson.M{})
+	if err != nil {
+		return nil, err
+	}
+
+	names := []string{}
+	for _, v := range res {
+		if name, ok := v.(string); ok {
+			names = append(names, name)
+		}
+	}
+
+	return names, nil
+}
+
+// FindHolders returns the ids of the users holding a contract of the instrument.
+func (cs *CollateralService) FindHolders(instrument string) ([]primitive.ObjectID, error) {
+	opts := options.Find().SetProjection(bson.M{"_id": 1})
+	users, err := cs.users.Find(bson.M{"collaterals.contracts.instrumentName": instrument}, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := []primitive.ObjectID{}
+	for _, u := range users {
+		ids = append(ids, u.ID)
+	}
+
+	return ids, nil
+}
@@ -0,0 +1,365 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"pickup/datasources/mongo"
+	"pickup/models/fee"
+	"time"
+
+	"github.com/Undercurrent-Technologies/kprime-utilities/models/trade"
+	"github.com/Undercurrent-Technologies/kprime-utilities/types"
+	"github.com/shopspring/decimal"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	mongodriver "go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// tradeCollection is the collection of the trades, owned by the gateway.
+const tradeCollection = "trades"
+
+var ErrInvalidGroup = errors.New("InvalidGroup")
+
+// Fee report groups
+var feeGroups = map[string]interface{}{
+	"day":        bson.M{"$dateToString": bson.M{"format": "%Y-%m-%d", "date": "$tradedAt"}},
+	"user":       "$userId",
+	"instrument": "$instrumentName",
+}
+
+// FeeReport is the fees collected and the rebates paid for a day, user or
+// instrument.
+type FeeReport struct {
+	Key      interface{} `json:"key" bson:"_id"`
+	Currency string      `json:"currency" bson:"currency"`
+	Fees     string      `json:"fees" bson:"fees"`
+	Rebates  string      `json:"rebates" bson:"rebates"`
+	Net      string      `json:"net" bson:"net"`
+	Total    int         `json:"total" bson:"total"`
+}
+
+// FeeConsistency compares, per currency, the fees of the trades with the fee
+// ledger and the fee revenue account.
+type FeeConsistency struct {
+	Currency   string `json:"currency"`
+	Trades     string `json:"trades"`
+	Ledger     string `json:"ledger"`
+	Account    string `json:"account"`
+	Consistent bool   `json:"consistent"`
+}
+
+// FeeService records the fee of every trade side in the fee ledger and
+// credits it to the fee revenue account of its currency. Fees are debited
+// from the collateral currency balance whatever the currency of the trade
+// fee, so they are recorded in the collateral currency.
+type FeeService struct {
+	fees     *mongo.Repository[fee.Fee]
+	accounts *mongo.Repository[fee.Account]
+	trades   *mongo.Repository[trade.Trade]
+}
+
+func NewFeeService() FeeService {
+	return FeeService{
+		fees:     mongo.NewRepository[fee.Fee](mongo.Database, fee.Collection),
+		accounts: mongo.NewRepository[fee.Account](mongo.Database, fee.AccountCollection),
+		trades:   mongo.NewRepository[trade.Trade](mongo.Database, tradeCollection),
+	}
+}
+
+// Record adds the fee of the user side of the trade to the ledger once and
+// credits it to the fee revenue account.
+func (fs *FeeService) Record(t *trade.Trade, us *trade.User) error {
+	return fs.insert(fee.Fee{
+		ID:             primitive.NewObjectID(),
+		TradeID:        t.ID,
+		UserID:         us.UserID,
+		Role:           feeRole(t, us),
+		InstrumentName: t.OrderCode(),
+		Currency:       collateralCurrency,
+		Amount:         feeAmount(us).String(),
+		TradedAt:       t.CreatedAt,
+		CreatedAt:      time.Now(),
+	})
+}
+
+// Recorded reports whether the user side of the trade was already applied.
+func (fs *FeeService) Recorded(t *trade.Trade, us *trade.User) bool {
+	return fs.fees.FindOne(bson.M{"tradeId": t.ID, "role": feeRole(t, us)}) != nil
+}
+
+// Applied reports whether any side of the trade was applied since the fee
+// ledger exists.
+func (fs *FeeService) Applied(tradeID primitive.ObjectID) bool {
+	return fs.fees.FindOne(bson.M{"tradeId": tradeID}) != nil
+}
+
+// Reversible returns the fees of the trade sides which were applied and not
+// reversed yet.
+func (fs *FeeService) Reversible(tradeID primitive.ObjectID) ([]fee.Fee, error) {
+	entries, err := fs.fees.Find(bson.M{"tradeId": tradeID})
+	if err != nil {
+		return nil, err
+	}
+
+	roles := map[string]bool{}
+	for _, e := range entries {
+		roles[e.Role] = true
+	}
+
+	res := []fee.Fee{}
+	for _, e := range entries {
+		if r, ok := fee.Reversals[e.Role]; ok && !roles[r] {
+			res = append(res, e)
+		}
+	}
+
+	return res, nil
+}
+
+// Reverse refunds the fee of a failed trade side once and debits it from the
+// fee revenue account.
+func (fs *FeeService) Reverse(f *fee.Fee) error {
+	return fs.insert(fee.Fee{
+		ID:             primitive.NewObjectID(),
+		TradeID:        f.TradeID,
+		UserID:         f.UserID,
+		Role:           fee.Reversals[f.Role],
+		InstrumentName: f.InstrumentName,
+		Currency:       f.Currency,
+		Amount:         f.GetAmount().Neg().String(),
+		TradedAt:       f.TradedAt,
+		CreatedAt:      time.Now(),
+	})
+}
+
+// insert adds the ledger entry unless an entry of the trade and role exists,
+// and credits the fee revenue account only when it was inserted.
+func (fs *FeeService) insert(f fee.Fee) error {
+	filter := bson.M{"tradeId": f.TradeID, "role": f.Role}
+	e, err := fs.fees.FindAndModify(filter, bson.M{"$setOnInsert": f})
+	if err != nil {
+		return err
+	}
+
+	if e == nil || e.ID != f.ID {
+		return nil
+	}
+
+	return fs.credit(f.Currency, f.GetAmount())
+}
+
+func (fs *FeeService) FindAccounts() ([]fee.Account, error) {
+	return fs.accounts.Find(bson.M{})
+}
+
+// Report sums the fees and rebates traded between from and to by day, user
+// or instrument.
+func (fs *FeeService) Report(group string, from, to *time.Time) ([]FeeReport, error) {
+	key, ok := feeGroups[group]
+	if !ok {
+		return nil, ErrInvalidGroup
+	}
+
+	amount := bson.M{"$toDecimal": "$amount"}
+	pipeline := []bson.M{
+		{"$match": tradedBetween("tradedAt", from, to)},
+		{"$group": bson.M{
+			"_id":      bson.M{"key": key, "currency": "$currency"},
+			"fees":     bson.M{"$sum": bson.M{"$cond": bson.A{bson.M{"$gt": bson.A{amount, 0}}, amount, 0}}},
+			"rebates":  bson.M{"$sum": bson.M{"$cond": bson.A{bson.M{"$lt": bson.A{amount, 0}}, amount, 0}}},
+			"net":      bson.M{"$sum": amount},
+			"total":    bson.M{"$sum": 1},
+			"currency": bson.M{"$first": "$currency"},
+		}},
+		{"$sort": bson.M{"_id": 1}},
+		{"$project": bson.M{
+			"_id":      "$_id.key",
+			"currency": 1,
+			"fees":     bson.M{"$toString": "$fees"},
+			"rebates":  bson.M{"$toString": bson.M{"$multiply": bson.A{"$rebates", -1}}},
+			"net":      bson.M{"$toString": "$net"},
+			"total":    1,
+		}},
+	}
+
+	res := []FeeReport{}
+	err := fs.fees.Aggregate(pipeline, &res)
+
+	return res, err
+}
+
+// Check verifies that the fees of the successful trades traded between from
+// and to equal the fee ledger and, without a range, the fee revenue account.
+func (fs *FeeService) Check(from, to *time.Time) ([]FeeConsistency, error) {
+	trades, err := fs.sumTrades(from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	ledger, err := fs.sum(tradedBetween("tradedAt", from, to))
+	if err != nil {
+		return nil, err
+	}
+
+	accounts, err := fs.FindAccounts()
+	if err != nil {
+		return nil, err
+	}
+
+	currencies := map[string]bool{}
+	for c := range trades {
+		currencies[c] = true
+	}
+	for c := range ledger {
+		currencies[c] = true
+	}
+
+	res := []FeeConsistency{}
+	for c := range currencies {
+		fc := FeeConsistency{
+			Currency: c,
+			Trades:   trades[c].String(),
+			Ledger:   ledger[c].String(),
+		}
+		fc.Consistent = trades[c].Equal(ledger[c])
+
+		if from == nil && to == nil {
+			account := decimal.Zero
+			for _, a := range accounts {
+				if a.Currency == c {
+					account, _ = decimal.NewFromString(a.Balance)
+				}
+			}
+
+			fc.Account = account.String()
+			fc.Consistent = fc.Consistent && account.Equal(ledger[c])
+		}
+
+		res = append(res, fc)
+	}
+
+	return res, nil
+}
+
+// credit adds the fee, or the rebate when negative, to the fee revenue
+// account of the currency. Amounts are stored as strings, so they are added
+// as decimals within the update.
+func (fs *FeeService) credit(currency string, amount decimal.Decimal) error {
+	if amount.IsZero() {
+		return nil
+	}
+
+	field, value := "fees", amount
+	if amount.IsNegative() {
+		field, value = "rebates", amount.Neg()
+	}
+
+	add := func(f string, v decimal.Decimal) bson.M {
+		return bson.M{"$toString": bson.M{"$add": bson.A{
+			bson.M{"$toDecimal": bson.M{"$ifNull": bson.A{"$" + f, "0"}}},
+			bson.M{"$toDecimal": v.String()},
+		}}}
+	}
+
+	update := mongodriver.Pipeline{{{Key: "$set", Value: bson.M{
+		"balance":   add("balance", amount),
+		field:       add(field, value),
+		"updatedAt": "$$NOW",
+	}}}}
+	_, err := fs.accounts.Collection().UpdateOne(context.Background(), bson.M{"_id": currency}, update, options.Update().SetUpsert(true))
+
+	return err
+}
+
+// sum returns the fee ledger total per currency.
+func (fs *FeeService) sum(match bson.M) (map[string]decimal.Decimal, error) {
+	pipeline := []bson.M{
+		{"$match": match},
+		{"$group": bson.M{"_id": "$currency", "amount": bson.M{"$sum": bson.M{"$toDecimal": "$amount"}}}},
+	}
+
+	return sumByCurrency(fs.fees, pipeline)
+}
+
+// sumTrades returns the fees of both sides of the successful trades which were
+// not rejected per currency. Trades created before the first ledger entry
+// were applied before the ledger existed and are left out.
+func (fs *FeeService) sumTrades(from, to *time.Time) (map[string]decimal.Decimal, error) {
+	first := fs.fees.FindOne(bson.M{}, options.FindOne().SetSort(bson.M{"tradedAt": 1}))
+	if first == nil {
+		return map[string]decimal.Decimal{}, nil
+	}
+
+	if from == nil || from.Before(first.TradedAt) {
+		from = &first.TradedAt
+	}
+
+	match := tradedBetween("createdAt", from, to)
+	match["status"] = bson.M{"$ne": types.FAILED}
+	match["rejection"] = bson.M{"$exists": false}
+
+	pipeline := []bson.M{
+		{"$match": match},
+		{"$project": bson.M{"fees": bson.A{"$taker.fee", "$maker.fee"}}},
+		{"$unwind": "$fees"},
+		{"$match": bson.M{"fees.amount": bson.M{"$exists": true}}},
+		{"$group": bson.M{
+			"_id":    collateralCurrency,
+			"amount": bson.M{"$sum": bson.M{"$toDecimal": "$fees.amount"}},
+		}},
+	}
+
+	return sumByCurrency(fs.trades, pipeline)
+}
+
+func sumByCurrency[T any](r *mongo.Repository[T], pipeline []bson.M) (map[string]decimal.Decimal, error) {
+	res := []struct {
+		Currency string               `bson:"_id"`
+		Amount   primitive.Decimal128 `bson:"amount"`
+	}{}
+	if err := r.Aggregate(pipeline, &res); err != nil {
+		return nil, err
+	}
+
+	sums := map[string]decimal.Decimal{}
+	for _, r := range res {
+		sums[r.Currency], _ = decimal.NewFromString(r.Amount.String())
+	}
+
+	return sums, nil
+}
+
+func tradedBetween(field string, from, to *time.Time) bson.M {
+	match := bson.M{}
+	if from == nil && to == nil {
+		return match
+	}
+
+	r := bson.M{}
+	if from != nil {
+		r["$gte"] = *from
+	}
+	if to != nil {
+		r["$lt"] = *to
+	}
+	match[field] = r
+
+	return match
+}
+
+func feeRole(t *trade.Trade, us *trade.User) string {
+	if us == t.Taker {
+		return fee.Taker
+	}
+
+	return fee.Maker
+}
+
+func feeAmount(us *trade.User) decimal.Decimal {
+	if us.Fee == nil {
+		return decimal.Zero
+	}
+
+	return us.Fee.GetAmount()
+}
@@ -0,0 +1,109 @@
+package service
+
+import (
+	"net/http"
+	"pickup/app"
+	"pickup/datasources/collector"
+	"strconv"
+	"time"
+
+	"github.com/Undercurrent-Technologies/kprime-utilities/commons/logs"
+	"github.com/Undercurrent-Technologies/kprime-utilities/models/system"
+	"github.com/Undercurrent-Technologies/kprime-utilities/types"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+var gatewayClient = &http.Client{Timeout: 5 * time.Second}
+
+// gatewayProbe counts consecutive health check results so that the gateway
+// status only changes after several identical results in a row.
+type gatewayProbe struct {
+	successes int
+	failures  int
+}
+
+// observe records a health check result and returns true once the result
+// has been seen enough times in a row to change the status.
+func (g *gatewayProbe) observe(healthy bool) bool {
+	if healthy {
+		g.successes++
+		g.failures = 0
+		return g.successes >= parseInt(app.Config.Gateway.SuccessThreshold, 3)
+	}
+
+	g.failures++
+	g.successes = 0
+	return g.failures >= parseInt(app.Config.Gateway.FailureThreshold, 3)
+}
+
+func (js *JobService) GatewayMonitoring() {
+	healthy := js.probeGateway()
+	decided := js.gateway.observe(healthy)
+
+	s := findSystem(js.system)
+	if s == nil {
+		return
+	}
+
+	status := s.Status.Gateway
+	reason := ""
+	if decided {
+		status = types.OFF
+		reason = "HEALTH_CHECK_FAILED"
+		if healthy {
+			status = types.ON
+			reason = "HEALTH_CHECK_PASSED"
+		}
+	}
+
+	// Keep the gateway OFF while the engine is halted for nonce divergence
+	offOnNonceDiff, _ := strconv.ParseBool(app.Config.Gateway.OffOnNonceDiff)
+	if offOnNonceDiff && s.Status.Engine == types.OFF && js.override.Find(s) == nil {
+		status = types.OFF
+		reason = ReasonNonceDiff
+	}
+
+	setGatewayMetric(status == types.ON)
+
+	if status == s.Status.Gateway {
+		return
+	}
+
+	js.updateGateway(s, status == types.ON, reason)
+}
+
+func (js *JobService) probeGateway() bool {
+	url := app.Config.GatewayURL + app.Config.Gateway.HealthPath
+	res, err := gatewayClient.Get(url)
+	if err != nil {
+		return false
+	}
+	defer res.Body.Close()
+
+	return res.StatusCode >= 200 && res.StatusCode < 300
+}
+
+func (js *JobService) updateGateway(s *system.System, on bool, reason string) {
+	s.Status.Gateway = types.OFF
+	if on {
+		s.Status.Gateway = types.ON
+	}
+	s.UpdatedAt = time.Now()
+
+	filter := bson.M{"_id": s.ID}
+	update := bson.M{"$set": bson.M{"status.gateway": s.Status.Gateway, "updatedAt": s.UpdatedAt}}
+	if _, err := js.system.FindAndModify(filter, update); err != nil {
+		logs.Log.Error().Err(err).Msg("Failed to update gateway status")
+		return
+	}
+
+	logs.Log.Info().Str("reason", reason).Msgf("Gateway is %s", s.Status.Gateway.String())
+}
+
+func setGatewayMetric(on bool) {
+	if on {
+		collector.GatewayStatusGauge.Set(1)
+	} else {
+		collector.GatewayStatusGauge.Set(0)
+	}
+}
@@ -0,0 +1,164 @@
+package service
+
+import (
+	"pickup/app"
+	"pickup/datasources/mongo"
+	"pickup/models/instrument"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Undercurrent-Technologies/kprime-utilities/commons/logs"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// Instrument registry sources
+const (
+	RegistryMongo  = "mongo"
+	RegistryConfig = "config"
+)
+
+// InstrumentRegistry holds the instruments listed by the exchange, loaded from
+// the instruments collection or the INSTRUMENTS config and refreshed
+// periodically. Without a source any valid instrument name is listed and the
+// check is not enforced.
+type InstrumentRegistry struct {
+	source      string
+	instruments *mongo.Repository[instrument.Record]
+	listed      map[string]*instrument.Instrument
+	loadedAt    time.Time
+	refresh     time.Duration
+	alerted     map[string]time.Time
+	alertEvery  time.Duration
+	mutex       *sync.Mutex
+}
+
+func NewInstrumentRegistry() *InstrumentRegistry {
+	ir := &InstrumentRegistry{
+		source:     app.Config.Instrument.Registry,
+		refresh:    time.Duration(parseInt(app.Config.Instrument.RefreshInterval, 60000)) * time.Millisecond,
+		alerted:    map[string]time.Time{},
+		alertEvery: time.Duration(parseInt(app.Config.Instrument.AlertInterval, 3600000)) * time.Millisecond,
+		mutex:      &sync.Mutex{},
+	}
+
+	if ir.source == RegistryMongo {
+		ir.instruments = mongo.NewRepository[instrument.Record](mongo.Database, instrument.Collection)
+	}
+
+	return ir
+}
+
+// Enforced tells whether trades failing the check are rejected, which is only
+// the case when a registry source is configured.
+func (ir *InstrumentRegistry) Enforced() bool {
+	return ir.source == RegistryMongo || ir.source == RegistryConfig
+}
+
+// Check parses the instrument and verifies it is listed and not expired at
+// the given time. Names are compared by their code, so that listed names and
+// trade instruments with differently formatted strikes match.
+func (ir *InstrumentRegistry) Check(name string, at time.Time) (*instrument.Instrument, error) {
+	i, err := instrument.Parse(name)
+	if err != nil {
+		return nil, err
+	}
+
+	if ir.Enforced() {
+		if _, ok := ir.load()[i.Code()]; !ok {
+			return i, instrument.ErrUnknownInstrument
+		}
+	}
+
+	if i.Expired(at) {
+		return i, instrument.ErrExpiredInstrument
+	}
+
+	return i, nil
+}
+
+// load returns the listed instruments, reloading them once stale. The
+// previous instruments are kept when reloading fails.
+func (ir *InstrumentRegistry) load() map[string]*instrument.Instrument {
+	ir.mutex.Lock()
+	defer ir.mutex.Unlock()
+
+	if ir.listed != nil && time.Since(ir.loadedAt) < ir.refresh {
+		return ir.listed
+	}
+
+	names, err := ir.names()
+	if err != nil {
+		logs.Log.Error().Err(err).Msg("Failed to load instruments")
+		if ir.listed == nil {
+			return map[string]*instrument.Instrument{}
+		}
+		return ir.listed
+	}
+
+	listed := map[string]*instrument.Instrument{}
+	for _, name := range names {
+		i, err := instrument.Parse(name)
+		if err != nil {
+			logs.Log.Warn().Str("instrument", name).Msg("Unable to parse listed instrument")
+			continue
+		}
+
+		listed[i.Code()] = i
+	}
+
+	ir.listed = listed
+	ir.loadedAt = time.Now()
+
+	return listed
+}
+
+// AlertDue reports whether an alert about the instrument is due, at most once
+// every INSTRUMENT_ALERT_INTERVAL milliseconds per instrument.
+func (ir *InstrumentRegistry) AlertDue(name string) bool {
+	ir.mutex.Lock()
+	defer ir.mutex.Unlock()
+
+	if at, ok := ir.alerted[name]; ok && time.Since(at) < ir.alertEvery {
+		return false
+	}
+	ir.alerted[name] = time.Now()
+
+	return true
+}
+
+func (ir *InstrumentRegistry) names() ([]string, error) {
+	names := []string{}
+	if ir.source == RegistryConfig {
+		for _, name := range strings.Split(app.Config.Instrument.Names, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				names = append(names, name)
+			}
+		}
+
+		return names, nil
+	}
+
+	records, err := ir.instruments.Find(bson.M{"active": bson.M{"$ne": false}})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, r := range records {
+		names = append(names, r.Name)
+	}
+
+	return names, nil
+}
+
+// instrumentFilter narrows orders and trades to the underlying and expiry of
+// the instrument name. The full name has to be matched on the decoded
+// documents since the strike is not stored as formatted in the name.
+func instrumentFilter(name string) bson.M {
+	parts := strings.Split(name, "-")
+	if len(parts) != 4 {
+		return bson.M{}
+	}
+
+	return bson.M{"underlying": parts[0], "expiryDate": parts[1]}
+}
@@ -1,13 +1,17 @@
 package service
 
 import (
-	"encoding/json"
+	"context"
+	"errors"
 	"fmt"
-	"io/ioutil"
-	"math"
-	"net/http"
 	"pickup/app"
+	"pickup/datasources/collector"
+	"pickup/datasources/engine"
+	"pickup/datasources/kafka"
+	"pickup/models/override"
+	"pickup/models/status"
 	"strconv"
+	"sync"
 	"time"
 
 	"github.com/Undercurrent-Technologies/kprime-utilities/commons/logs"
@@ -20,124 +24,261 @@ import (
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
-var isError bool = false
+var ErrSystemNotFound = errors.New("SystemNotFound")
+
+// Reasons of engine status changes
+const (
+	ReasonNonceMatched = "NONCE_MATCHED"
+	ReasonNonceDiff    = "NONCE_DIFF"
+	ReasonOverride     = "OPERATOR_OVERRIDE"
+	ReasonResynced     = "RESYNCED"
+)
 
 type JobService struct {
 	system   interfaces.Repository[system.System]
 	activity interfaces.Repository[activity.Activity]
+	override OverrideService
+	gateway  *gatewayProbe
+	engine   *engine.Client
+	nonce    *nonceMonitor
+	notifier StatusNotifier
+	resync   *ResyncService
+
+	// engineError tells whether the matching engine was unreachable on the
+	// last run, mutex serializes the scheduled and admin-triggered runs.
+	engineError bool
+	mutex       *sync.Mutex
 }
 
-func NewJobService(r *mongodb.Repositories) JobService {
-	return JobService{system: r.System, activity: r.Activity}
+func NewJobService(k *kafka.Kafka, r *mongodb.Repositories, ms *ManagerService) JobService {
+	ec := newEngineClient()
+
+	return JobService{
+		system:   r.System,
+		activity: r.Activity,
+		override: NewOverrideService(r),
+		gateway:  &gatewayProbe{},
+		engine:   ec,
+		nonce:    newNonceMonitor(),
+		notifier: NewStatusNotifier(k, ms.stream),
+		resync:   NewResyncService(ec, ms),
+		mutex:    &sync.Mutex{},
+	}
 }
 
-func (js *JobService) NonceMonitoring() {
-	// Default nonce difference
-	nonceDiff, err := strconv.ParseFloat(app.Config.NonceDiff, 64)
-	if err != nil {
-		nonceDiff = 20
+func newEngineClient() *engine.Client {
+	ms := func(v string, def int) time.Duration {
+		return time.Duration(parseInt(v, def)) * time.Millisecond
 	}
 
-	// Fetch nonce
-	mongoNonce := js.fetchMongoNonce()
-	engineNonce := js.fetchMatchingEngineNonce()
+	return engine.NewClient(engine.Config{
+		URL:              app.Config.MatchingEngineURL,
+		Timeout:          ms(app.Config.Engine.Timeout, 2000),
+		Retries:          parseInt(app.Config.Engine.Retries, 2),
+		Backoff:          ms(app.Config.Engine.Backoff, 200),
+		BreakerThreshold: parseInt(app.Config.Engine.BreakerThreshold, 5),
+		BreakerCooldown:  ms(app.Config.Engine.BreakerCooldown, 10000),
+	})
+}
+
+func (js *JobService) NonceMonitoring() {
+	js.mutex.Lock()
+	defer js.mutex.Unlock()
 
 	// Fetch current system
-	s := js.system.FindOne(bson.M{})
-	now := time.Now()
+	s := findSystem(js.system)
 	if s == nil {
-		status := system.Status{Engine: types.ON, Gateway: types.ON}
-		s = &system.System{ID: primitive.NewObjectID(), Status: status, CreatedAt: now, UpdatedAt: now}
-		if _, err := js.system.Create(s); err != nil {
-			return
-		}
+		return
+	}
+
+	setEngineMetric(s)
+
+	// Fetch nonce
+	mongoNonce, mongoErr := js.fetchMongoNonce()
+	engineNonce, engineErr := js.fetchMatchingEngineNonce()
+
+	// Operator override takes precedence over nonce monitoring
+	if o := js.override.Find(s); o != nil {
+		js.applyOverride(s, o, engineNonce, mongoNonce)
+		return
+	}
+
+	// Skip the decision while any nonce is unknown
+	if mongoErr != nil || engineErr != nil {
+		return
 	}
 
 	// Handle engine status
-	if engineNonce == mongoNonce {
-		// Start engine
-		if s.Status.Engine == types.ON {
-			return
-		}
+	gap := engineNonce - mongoNonce
+	if gap < 0 {
+		gap = -gap
+	}
 
+	old := s.Status.Engine.String()
+	reason := ""
+	switch js.nonce.observe(gap, s.Status.Engine == types.ON) {
+	case nonceResume:
 		s.Status.Engine = types.ON
-	} else if math.Abs(engineNonce-mongoNonce) > nonceDiff {
-		// Stop engine
-		if s.Status.Engine == types.OFF {
-			return
-		}
-
+		reason = ReasonNonceMatched
+	case nonceHalt:
 		s.Status.Engine = types.OFF
-	} else {
+		reason = ReasonNonceDiff
+	default:
 		// Doing nothing
+		js.resyncIfBehind(s, engineNonce, mongoNonce)
 		return
 	}
 
-	js.updateSystem(s, int(engineNonce), int(mongoNonce))
+	js.updateSystem(s, old, engineNonce, mongoNonce, reason)
+	js.resyncIfBehind(s, engineNonce, mongoNonce)
 }
 
-func (js *JobService) fetchMatchingEngineNonce() (nonce float64) {
-	url := fmt.Sprintf("%s/api/v1/activities/nonce", app.Config.MatchingEngineURL)
-	res, err := http.Get(url)
-	if err != nil {
-		if !isError {
-			logs.Log.Error().Err(err).Msg("Matching engine is DISCONNECTED!")
-			isError = true
-		}
-		return 0
-	} else {
-		if isError {
-			logs.Log.Info().Msg("Matching engine is CONNECTED!")
-			isError = false
-		}
+// resyncIfBehind catches mongo up with the matching engine while the engine
+// is halted, then resumes it.
+func (js *JobService) resyncIfBehind(s *system.System, en, mn int64) {
+	if !js.resync.Enabled() || s.Status.Engine != types.OFF || mn >= en {
+		return
+	}
+
+	js.resync.Start(mn+1, en, js.resumeAfterResync)
+}
+
+func (js *JobService) resumeAfterResync() {
+	js.mutex.Lock()
+	defer js.mutex.Unlock()
+
+	s := findSystem(js.system)
+	if s == nil || s.Status.Engine == types.ON || js.override.Find(s) != nil {
+		return
 	}
 
-	if res.StatusCode != 200 {
-		logs.Log.Error().Msg(res.Status)
-		return 0
+	mongoNonce, mongoErr := js.fetchMongoNonce()
+	engineNonce, engineErr := js.fetchMatchingEngineNonce()
+	if mongoErr != nil || engineErr != nil || mongoNonce != engineNonce {
+		return
 	}
 
-	data, err := ioutil.ReadAll(res.Body)
-	if err != nil {
-		logs.Log.Error().Err(err).Msg("Failed to read data!")
-		return 0
+	old := s.Status.Engine.String()
+	s.Status.Engine = types.ON
+	js.updateSystem(s, old, engineNonce, mongoNonce, ReasonResynced)
+}
+
+func (js *JobService) applyOverride(s *system.System, o *override.Override, en, mn int64) {
+	target := types.ON
+	if o.Status == types.OFF.String() {
+		target = types.OFF
+	}
+
+	if s.Status.Engine == target {
+		return
 	}
 
-	result := map[string]interface{}{}
-	err = json.Unmarshal(data, &result)
+	old := s.Status.Engine.String()
+	s.Status.Engine = target
+	js.updateSystem(s, old, en, mn, ReasonOverride)
+}
+
+func (js *JobService) fetchMatchingEngineNonce() (int64, error) {
+	nonce, err := js.engine.FetchNonce(context.Background())
 	if err != nil {
-		logs.Log.Error().Err(err).Msg("Failed to decode data!")
-		return 0
+		if !js.engineError {
+			logs.Log.Error().Err(err).Msg("Matching engine is DISCONNECTED!")
+			js.engineError = true
+		}
+		return 0, err
 	}
 
-	activity := result["data"].(map[string]interface{})
-	return activity["data"].(float64)
+	if js.engineError {
+		logs.Log.Info().Msg("Matching engine is CONNECTED!")
+		js.engineError = false
+	}
+
+	return nonce, nil
 }
 
-func (js *JobService) fetchMongoNonce() (nonce float64) {
-	pipeline := []bson.M{{"$sort": bson.M{"nonce": -1}}, {"$limit": 1}}
-	activities, _ := js.activity.Aggregate(pipeline)
-	if len(activities) > 0 {
-		return float64(activities[0].Nonce)
+// fetchMongoNonce returns the last applied nonce, including archived
+// activities.
+func (js *JobService) fetchMongoNonce() (int64, error) {
+	nonce, err := lastNonce(js.activity)
+	if err != nil {
+		logs.Log.Error().Err(err).Msg("Failed to fetch mongo nonce!")
+		return 0, err
 	}
 
-	return 0
+	return nonce, nil
 }
 
-func (js *JobService) updateSystem(s *system.System, en, mn int) {
+func (js *JobService) updateSystem(s *system.System, old string, en, mn int64, reason string) {
 	s.UpdatedAt = time.Now()
 
+	// Only the engine status is written, the system document may have been
+	// changed since it was read, e.g. the gateway status
 	filter := bson.M{"_id": s.ID}
-	update := bson.M{"$set": s}
+	update := bson.M{"$set": bson.M{"status.engine": s.Status.Engine, "updatedAt": s.UpdatedAt}}
 
 	if _, err := js.system.FindAndModify(filter, update); err == nil {
+		js.nonce.changed()
+		setEngineMetric(s)
+
 		msg := fmt.Sprintf("Matching engine is %s", s.Status.Engine.String())
-		logs.Log.Info().Msg(msg)
+		logs.Log.Info().Str("reason", reason).Msg(msg)
 
-		if s.Status.Engine == types.OFF {
+		if s.Status.Engine == types.OFF && reason == ReasonNonceDiff {
 			msg := fmt.Sprintf("Nonce is over %s", app.Config.NonceDiff)
-			data := map[string]int{"engine": en, "mongo": mn}
+			data := map[string]int64{"engine": en, "mongo": mn}
 			logs.Log.Info().Any("nonce", data).Msg(msg)
 		}
+
+		js.notifier.Notify(&status.Change{
+			ID:          primitive.NewObjectID(),
+			OldStatus:   old,
+			NewStatus:   s.Status.Engine.String(),
+			EngineNonce: en,
+			MongoNonce:  mn,
+			Reason:      reason,
+			CreatedAt:   s.UpdatedAt,
+		})
 	}
 }
+
+// NonceMonitoringScheduled tells whether nonce monitoring runs on schedule,
+// which is what gives control back to nonce monitoring once an override
+// expires.
+func NonceMonitoringScheduled() bool {
+	enabled, _ := strconv.ParseBool(app.Config.Scheduler.NonceMonitoring)
+	return enabled && parseInt(app.Config.Scheduler.MonitoringInterval, 1000) > 0
+}
+
+// findSystem returns the system document, creating it when it does not exist yet.
+func findSystem(r interfaces.Repository[system.System]) *system.System {
+	s := r.FindOne(bson.M{})
+	if s != nil {
+		return s
+	}
+
+	now := time.Now()
+	st := system.Status{Engine: types.ON, Gateway: types.ON}
+	s = &system.System{ID: primitive.NewObjectID(), Status: st, CreatedAt: now, UpdatedAt: now}
+	if _, err := r.Create(s); err != nil {
+		return nil
+	}
+
+	return s
+}
+
+func setEngineMetric(s *system.System) {
+	if s.Status.Engine == types.ON {
+		collector.EngineStatusGauge.Set(1)
+	} else {
+		collector.EngineStatusGauge.Set(0)
+	}
+}
+
+func parseInt(v string, def int) int {
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		return def
+	}
+
+	return n
+}
@@ -1,10 +1,17 @@
 package service
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"pickup/datasources/collector"
 	"pickup/datasources/kafka"
+	"pickup/datasources/mongo"
+	"pickup/models/notification"
+	"pickup/models/offset"
+	"pickup/models/rejection"
+	"pickup/models/reversal"
 	"sync"
 	"time"
 
@@ -17,38 +24,58 @@ import (
 	"github.com/Undercurrent-Technologies/kprime-utilities/models/user"
 	"github.com/Undercurrent-Technologies/kprime-utilities/repository/mongodb"
 	"github.com/Undercurrent-Technologies/kprime-utilities/types"
+	"github.com/shopspring/decimal"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
 
 	kafkago "github.com/segmentio/kafka-go"
 )
 
 var logger = log.Logger
 
+var ErrTopicNotFound = errors.New("TopicNotFound")
+
 type PickupResult struct {
 	orders      []*order.Order
 	trades      []*trade.Trade
+	rejected    *rejection.Order
+	query       *CancelQuery
+	cancelled   bool
 	data        interface{}
+	topic       string
 	nonce       int64
 	kafkaOffset int64
 }
 
+// rejectedResponse holds the rejection reason of an engine response.
+type rejectedResponse struct {
+	Reason  string `json:"reason"`
+	Message string `json:"message"`
+}
+
 type ManagerService struct {
 	kafkaConn        *kafka.Kafka
 	repositories     *mongodb.Repositories
 	nonce            int64
 	requestDurations collector.RequestDurations
+	chain            ChainService
+	collateral       CollateralService
+	reservation      ReservationService
+	position         PositionService
+	instruments      *InstrumentRegistry
+	fee              FeeService
+	rejected         *mongo.Repository[rejection.Order]
+	offsets          *mongo.Repository[offset.Processed]
+	retention        RetentionService
+	events           []notification.Event
+	stream           *StreamService
 	mutex            *sync.Mutex
 }
 
-func NewManagerService(k *kafka.Kafka, r *mongodb.Repositories) ManagerService {
-	n := int64(0)
-	p := []bson.M{{"$sort": bson.M{"createdAt": -1}}, {"$limit": 1}}
-	acts, _ := r.Activity.Aggregate(p)
-	if len(acts) > 0 {
-		n = acts[0].Nonce
-	}
-
+// NewManagerService creates the manager starting from the last applied nonce
+// determined by Recover, streaming the saved activities to st.
+func NewManagerService(k *kafka.Kafka, r *mongodb.Repositories, n int64, st *StreamService) ManagerService {
 	rd := collector.RequestDurations{
 		RequestDurations: map[string]collector.RequestDuration{},
 		Mutex:            &sync.Mutex{},
@@ -59,6 +86,16 @@ func NewManagerService(k *kafka.Kafka, r *mongodb.Repositories) ManagerService {
 		repositories:     r,
 		nonce:            n,
 		requestDurations: rd,
+		chain:            NewChainService(k),
+		collateral:       NewCollateralService(),
+		reservation:      NewReservationService(),
+		position:         NewPositionService(),
+		instruments:      NewInstrumentRegistry(),
+		fee:              NewFeeService(),
+		rejected:         mongo.NewRepository[rejection.Order](mongo.Database, rejection.Collection),
+		offsets:          mongo.NewRepository[offset.Processed](mongo.Database, offset.Collection),
+		retention:        NewRetentionService(),
+		stream:           st,
 		mutex:            &sync.Mutex{},
 	}
 }
@@ -71,9 +108,32 @@ func (m *ManagerService) HandlePickup(msg kafkago.Message) {
 	activityId := primitive.NewObjectID()
 	go m.requestDurations.StartRequestDuration(msg.Topic, activityId.Hex())
 
+	if err := m.pickup(activityId, msg, true); err != nil {
+		logs.Log.Error().Err(err).Msg("Failed processing order")
+		go m.commit(msg)
+		go m.requestDurations.EndRequestDuration(msg.Topic, activityId.Hex(), false)
+		return
+	}
+
+	go m.requestDurations.EndRequestDuration(msg.Topic, activityId.Hex(), true)
+
+	return
+}
+
+// Apply persists a message which was not consumed from kafka, e.g. an
+// activity fetched from the matching engine during resync.
+func (m *ManagerService) Apply(msg kafkago.Message) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	return m.pickup(primitive.NewObjectID(), msg, false)
+}
+
+func (m *ManagerService) pickup(activityId primitive.ObjectID, msg kafkago.Message, commit bool) error {
 	// Initialize data
 	var res *PickupResult
 	var err error
+	var reversals []reversal.Reversal
 
 	switch msg.Topic {
 	case types.ENGINE.String():
@@ -81,25 +141,59 @@ func (m *ManagerService) HandlePickup(msg kafkago.Message) {
 	case types.CANCELLED_ORDER.String():
 		res, err = m.processCancelledOrders(msg)
 	default:
-		return
+		return ErrTopicNotFound
 	}
 
 	if err != nil {
-		logs.Log.Error().Err(err).Msg("Failed processing order")
-		go m.kafkaConn.Commit(msg)
-		go m.requestDurations.EndRequestDuration(msg.Topic, activityId.Hex(), false)
-		return
+		return err
 	}
+	res.topic = msg.Topic
 
-	m.updateOrders(res.orders)
-	m.updateTrades(res.trades)
-	m.kafkaConn.Commit(msg)
-	m.insertActivity(activityId, res)
-	m.publishSaved(msg)
+	m.events = nil
 
-	go m.requestDurations.EndRequestDuration(msg.Topic, activityId.Hex(), true)
+	// Skip nonce which has already been applied, e.g. by resync, or archived
+	if m.repositories.Activity.FindOne(bson.M{"nonce": res.nonce}) != nil || m.retention.FindIndex(res.nonce) != nil {
+		if commit {
+			m.commit(msg)
+		}
+		return nil
+	}
 
-	return
+	m.saveRejectedOrder(res.rejected)
+	if res.query != nil {
+		if d := m.verifyCancel(res.query, res.orders, res.nonce); d != nil {
+			res.data.(map[string]interface{})["discrepancies"] = d
+		}
+	}
+
+	res.orders = m.updateOrders(res.orders)
+	res.trades, reversals = m.updateTrades(res.trades)
+	if len(reversals) > 0 {
+		if res.data, err = withReversals(res.data, reversals); err != nil {
+			logs.Log.Error().Err(err).Int64("nonce", res.nonce).Msg("Failed to record reversals")
+		}
+	}
+	if res.cancelled {
+		m.reservation.Release(res.orders)
+	} else {
+		m.reservation.Apply(res.orders)
+	}
+	if commit {
+		m.commit(msg)
+	}
+	err = m.insertActivity(activityId, res)
+	if err != nil {
+		// Events are only published for nonces recorded in the activities
+		logs.Log.Error().Err(err).Int64("nonce", res.nonce).Int("events", len(m.events)).Msg("Failed to insert activity, user events dropped")
+		m.events = nil
+	}
+	m.publishSaved(msg, res)
+	m.publishNotifications(res.nonce)
+	if err == nil {
+		m.stream.PublishActivity(activityId, msg.Topic, res.trades)
+	}
+
+	return nil
 }
 
 func (m *ManagerService) processEngine(msg kafkago.Message) (res *PickupResult, err error) {
@@ -114,7 +208,7 @@ func (m *ManagerService) processEngine(msg kafkago.Message) (res *PickupResult,
 	}
 
 	if e.Status == types.ORDER_REJECTED {
-		return nil, errors.New("OrderRejected")
+		return m.processRejectedOrder(msg, e)
 	}
 
 	res = &PickupResult{
@@ -140,6 +234,46 @@ func (m *ManagerService) processEngine(msg kafkago.Message) (res *PickupResult,
 	return res, nil
 }
 
+// processRejectedOrder records the order rejected by the engine, so that its
+// nonce still gets an activity.
+func (m *ManagerService) processRejectedOrder(msg kafkago.Message, e *model.EngineResponse) (*PickupResult, error) {
+	// The reason is optional, a message it cannot be read from keeps the
+	// default reason
+	r := rejectedResponse{}
+	if err := json.Unmarshal(msg.Value, &r); err != nil {
+		logs.Log.Warn().Err(err).Int64("nonce", e.Nonce).Msg("Failed to read rejection reason, using default")
+		r = rejectedResponse{}
+	}
+
+	reason := r.Reason
+	if reason == "" {
+		reason = r.Message
+	}
+	if reason == "" {
+		reason = string(types.ORDER_REJECTED)
+	}
+
+	rejected := &rejection.Order{ID: primitive.NewObjectID(), Nonce: e.Nonce, Reason: reason, CreatedAt: time.Now()}
+	if e.Matches != nil && e.Matches.TakerOrder != nil {
+		rejected.ID = e.Matches.TakerOrder.ID
+		rejected.Order = e.Matches.TakerOrder
+	}
+
+	res := &PickupResult{
+		orders:      []*order.Order{},
+		trades:      []*trade.Trade{},
+		rejected:    rejected,
+		nonce:       e.Nonce,
+		kafkaOffset: msg.Offset,
+		data: map[string]interface{}{
+			"rejectedOrder": rejected.Order,
+			"reason":        reason,
+		},
+	}
+
+	return res, nil
+}
+
 func (m *ManagerService) processCancelledOrders(msg kafkago.Message) (res *PickupResult, err error) {
 	v := msg.Value
 	c := &model.CancelledOrder{}
@@ -154,6 +288,8 @@ func (m *ManagerService) processCancelledOrders(msg kafkago.Message) (res *Picku
 	res = &PickupResult{
 		orders:      c.Data,
 		trades:      []*trade.Trade{},
+		query:       parseCancelQuery(c.Query),
+		cancelled:   true,
 		nonce:       c.Nonce,
 		kafkaOffset: msg.Offset,
 		data: map[string]interface{}{
@@ -164,108 +300,271 @@ func (m *ManagerService) processCancelledOrders(msg kafkago.Message) (res *Picku
 	return res, nil
 }
 
-func (m *ManagerService) updateOrders(o []*order.Order) {
+// updateOrders persists the orders moving to a legal state and returns them.
+func (m *ManagerService) updateOrders(o []*order.Order) []*order.Order {
+	accepted := []*order.Order{}
 	for _, order := range o {
 		filter := bson.M{"_id": order.ID}
+		old := m.repositories.Order.FindOne(filter)
+		if err := checkOrder(old, order); err != nil {
+			continue
+		}
+
 		update := bson.M{"$set": order}
+		if _, err := m.repositories.Order.FindAndModify(filter, update); err != nil {
+			continue
+		}
 
-		m.repositories.Order.FindAndModify(filter, update)
+		m.notifyOrder(old, order)
+		accepted = append(accepted, order)
 	}
+
+	return accepted
 }
 
-func (m *ManagerService) updateTrades(t []*trade.Trade) error {
+// updateTrades applies the successful trades moving to a legal state to the
+// collaterals and persists them. Trades are persisted once applied, so that a
+// trade which failed to apply is applied again when sent again. Failed trades
+// which were applied are reversed, the persisted trades and the reversals to
+// be recorded in the activity are returned.
+func (m *ManagerService) updateTrades(t []*trade.Trade) ([]*trade.Trade, []reversal.Reversal) {
+	accepted := []*trade.Trade{}
+	reversals := []reversal.Reversal{}
 	for _, trade := range t {
 		filter := bson.M{"_id": trade.ID}
+		old := m.repositories.Trade.FindOne(filter)
+		if err := checkTrade(old, trade); err != nil {
+			continue
+		}
+
+		// Rejected trades are persisted with the rejection, nothing is applied
 		update := bson.M{"$set": trade}
+		var rejection error
+		if trade.Status == types.SUCCESS {
+			rejection = m.checkInstrument(trade)
+		}
+		if rejection != nil {
+			set, err := withRejection(trade, rejection)
+			if err != nil {
+				continue
+			}
+			update = bson.M{"$set": set}
+		}
+
+		if rejection == nil && trade.Status == types.SUCCESS {
+			if err := m.applySides(old, trade); err != nil {
+				logs.Log.Error().Err(err).Any("tradeId", trade.ID).Msg("Failed to apply trade")
+				continue
+			}
+		}
 
 		if _, err := m.repositories.Trade.FindAndModify(filter, update); err != nil {
 			continue
 		}
+		accepted = append(accepted, trade)
 
-		if trade.Status == types.FAILED {
-			continue
+		if rejection == nil && trade.Status == types.FAILED {
+			reversals = append(reversals, m.reverseTrade(trade)...)
 		}
+	}
 
-		m.updateUserCollateral(trade, trade.Taker)
-		m.updateUserCollateral(trade, trade.Maker)
+	return accepted, reversals
+}
+
+// applySides applies both sides of the successful trade once. Trades stored
+// as successful without fee ledger entries were applied before the ledger
+// existed and are not applied again.
+func (m *ManagerService) applySides(old, t *trade.Trade) error {
+	if old != nil && old.Status == types.SUCCESS && !m.fee.Applied(t.ID) {
+		logs.Log.Warn().Any("tradeId", t.ID).Msg("Trade applied before the fee ledger, skipped")
+		return nil
 	}
 
-	return nil
+	if err := m.updateUserCollateral(t, t.Taker); err != nil {
+		return err
+	}
+
+	return m.updateUserCollateral(t, t.Maker)
+}
+
+// checkInstrument alerts about trades on invalid, unlisted or expired
+// instruments and rejects them when the instrument registry is enforced.
+// Without a registry the alerts are rate-limited per instrument.
+func (m *ManagerService) checkInstrument(t *trade.Trade) error {
+	at := t.CreatedAt
+	if at.IsZero() {
+		at = time.Now()
+	}
+
+	name := t.OrderCode()
+	_, err := m.instruments.Check(name, at)
+	if err == nil {
+		return nil
+	}
+
+	collector.RejectedInstrumentCounter.WithLabelValues(err.Error()).Inc()
+	if !m.instruments.Enforced() {
+		logs.Log.Warn().Err(err).Any("tradeId", t.ID).Str("instrument", name).Msg("Trade instrument not checked")
+		if m.instruments.AlertDue(name) {
+			alert(fmt.Sprintf("Trade %s applied without instrument registry, instrument %s: %s", t.ID.Hex(), name, err.Error()))
+		}
+		return nil
+	}
+
+	logs.Log.Error().Err(err).Any("tradeId", t.ID).Str("instrument", name).Msg("Trade rejected")
+	alert(fmt.Sprintf("Trade %s rejected, instrument %s: %s", t.ID.Hex(), name, err.Error()))
+
+	return err
+}
+
+// withRejection returns the fields of the trade with the rejection, so that
+// the stored trade tells why its collaterals were not updated.
+func withRejection(t *trade.Trade, reason error) (bson.M, error) {
+	v, err := bson.Marshal(t)
+	if err != nil {
+		return nil, err
+	}
+
+	set := bson.M{}
+	if err := bson.Unmarshal(v, &set); err != nil {
+		return nil, err
+	}
+
+	set["rejection"] = bson.M{"reason": reason.Error(), "rejectedAt": time.Now()}
+
+	return set, nil
 }
 
-func (m *ManagerService) updateUserCollateral(t *trade.Trade, us *trade.User) {
+// updateUserCollateral applies the side of the user in the trade to the
+// collaterals, the position and the fee ledger. Each step is keyed on the
+// trade side, so that a side sent again after a failure only completes the
+// steps which are missing.
+func (m *ManagerService) updateUserCollateral(t *trade.Trade, us *trade.User) error {
+	// Successful trades sent again are applied once
+	if m.fee.Recorded(t, us) {
+		return nil
+	}
+
 	s := us.Side
 
 	i := t.OrderCode()
-	f := bson.M{"_id": us.UserID}
-	u := m.repositories.User.FindOne(f)
-	if u == nil {
-		logs.Log.Error().Any("userId", us.UserID).Msg("User not found")
-		return
+	p := t.GetAmount().Mul(t.GetPrice())
+	f := feeAmount(us)
+
+	var collaterals *user.Collaterals
+	applied, err := m.collateral.Apply(us.UserID, appliedKey(t.ID, feeRole(t, us)), func(c *user.Collaterals) bool {
+		applyTrade(c, i, s, t.GetAmount(), p, f)
+		collaterals = c
+		return true
+	})
+	if err != nil {
+		logs.Log.Error().Err(err).Any("userId", us.UserID).Msg("Failed to update user collateral")
+		return err
 	}
 
-	p := t.GetAmount().Mul(t.GetPrice())
+	if applied {
+		m.notifyTrade(notification.TradeExecuted, t, us)
+		m.notifyBalance(us.UserID, collaterals)
+	}
+
+	pos, err := m.position.Apply(t, us)
+	if err != nil {
+		logs.Log.Error().Err(err).Any("userId", us.UserID).Msg("Failed to update user position")
+		return err
+	}
+	m.notifyPosition(pos)
+
+	if err := m.fee.Record(t, us); err != nil {
+		logs.Log.Error().Err(err).Any("tradeId", t.ID).Msg("Failed to record trade fee")
+		return err
+	}
 
-	for _, bal := range u.Collaterals.Balances {
-		if bal.Currency != "USD" {
+	return nil
+}
+
+// applyTrade debits the premium and fee of a buy or credits the premium minus
+// the fee of a sell, and adds the amount to the contract of the instrument.
+func applyTrade(c *user.Collaterals, i string, s types.Side, amount, premium, fee decimal.Decimal) {
+	for _, bal := range c.Balances {
+		if bal.Currency != collateralCurrency {
 			continue
 		}
 
 		balance := bal.GetAmount()
 		if s == types.BUY {
-			bal.Amount = balance.Sub(p.Add(us.Fee.GetAmount())).String()
+			bal.Amount = balance.Sub(premium.Add(fee)).String()
 		} else {
-			bal.Amount = balance.Add(p.Sub(us.Fee.GetAmount())).String()
+			bal.Amount = balance.Add(premium.Sub(fee)).String()
 		}
 
 		break
 	}
 
-	exist := false
-	for _, con := range u.Collaterals.Contracts {
-		if con.InstrumentName == i {
-			exist = true
-
-			if s == types.BUY {
-				con.Amount = con.GetAmount().Add(t.GetAmount()).String()
-			} else {
-				con.Amount = con.GetAmount().Sub(t.GetAmount()).String()
-			}
+	if s == types.SELL {
+		amount = amount.Neg()
+	}
 
-			break
+	for _, con := range c.Contracts {
+		if con.InstrumentName == i {
+			con.Amount = con.GetAmount().Add(amount).String()
+			return
 		}
 	}
 
-	if !exist {
-		newContract := &user.Contract{InstrumentName: i}
-		if s == types.BUY {
-			newContract.Amount = t.Amount
-		} else {
-			newContract.Amount = "-" + t.Amount
-		}
+	c.Contracts = append(c.Contracts, &user.Contract{InstrumentName: i, Amount: amount.String()})
+}
 
-		u.Collaterals.Contracts = append(u.Collaterals.Contracts, newContract)
+func (m *ManagerService) saveRejectedOrder(r *rejection.Order) {
+	if r == nil {
+		return
 	}
 
-	m.repositories.User.FindAndModify(f, bson.M{"$set": u})
+	filter := bson.M{"_id": r.ID}
+	if _, err := m.rejected.FindAndModify(filter, bson.M{"$set": r}); err != nil {
+		logs.Log.Error().Err(err).Int64("nonce", r.Nonce).Msg("Failed to save rejected order")
+	}
 }
 
-func (m *ManagerService) publishSaved(msg kafkago.Message) error {
+func (m *ManagerService) publishSaved(msg kafkago.Message, res *PickupResult) error {
+	if res.rejected != nil {
+		return m.kafkaConn.Publish(kafkago.Message{Topic: rejection.SavedTopic.String(), Value: msg.Value})
+	}
+
 	switch msg.Topic {
 	case types.ENGINE.String():
 		return m.kafkaConn.Publish(kafkago.Message{Topic: types.ENGINE_SAVED.String(), Value: msg.Value})
 	case types.CANCELLED_ORDER.String():
 		return m.kafkaConn.Publish(kafkago.Message{Topic: types.CANCELLED_ORDER_SAVED.String(), Value: msg.Value})
 	default:
-		return errors.New("TopicNotFound")
+		return ErrTopicNotFound
 	}
 }
 
+// commit records the offset as processed before committing it, so that
+// recovery tells messages committed without activity, e.g. skipped or
+// failed ones, from messages committed without being processed.
+func (m *ManagerService) commit(msg kafkago.Message) {
+	filter := bson.M{"topic": msg.Topic, "partition": msg.Partition}
+	update := bson.M{"$max": bson.M{"offset": msg.Offset}, "$set": bson.M{"updatedAt": time.Now()}}
+	opts := options.Update().SetUpsert(true)
+	if _, err := m.offsets.Collection().UpdateOne(context.Background(), filter, update, opts); err != nil {
+		logs.Log.Error().Err(err).Str("topic", msg.Topic).Int64("offset", msg.Offset).Msg("Failed to record processed offset")
+	}
+
+	m.kafkaConn.Commit(msg)
+}
+
 func (m *ManagerService) insertActivity(id primitive.ObjectID, res *PickupResult) error {
 	activity := &activity.Activity{ID: id, Nonce: res.nonce, KafkaOffset: res.kafkaOffset, Data: res.data, CreatedAt: time.Now()}
 
+	chained, err := m.chain.Link(activity)
+	if err != nil {
+		return err
+	}
+	chained.Topic = res.topic
+
 	filter := bson.M{"_id": activity.ID}
-	update := bson.M{"$set": activity}
+	update := bson.M{"$set": chained}
 	if _, err := m.repositories.Activity.FindAndModify(filter, update); err != nil {
 		return err
 	}
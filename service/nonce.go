@@ -0,0 +1,88 @@
+package service
+
+import (
+	"pickup/app"
+	"strconv"
+	"sync"
+	"time"
+)
+
+type nonceDecision int
+
+const (
+	nonceKeep nonceDecision = iota
+	nonceHalt
+	nonceResume
+)
+
+// nonceMonitor decides engine status changes from consecutive nonce gap
+// samples so that a brief burst of engine throughput does not make the
+// engine status flap.
+type nonceMonitor struct {
+	prevGap    int64
+	hasPrev    bool
+	over       int
+	under      int
+	lastChange time.Time
+	mutex      *sync.Mutex
+}
+
+func newNonceMonitor() *nonceMonitor {
+	return &nonceMonitor{mutex: &sync.Mutex{}}
+}
+
+// observe records the gap between the engine and mongo nonce.
+//
+// The engine is halted once the gap is over NonceDiff for HaltSamples samples
+// in a row and is not shrinking, and resumed once the gap is at most
+// ResumeDiff for ResumeSamples samples in a row. No change happens within
+// MinStateDuration of the previous one.
+func (n *nonceMonitor) observe(gap int64, engineOn bool) nonceDecision {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	haltDiff, err := strconv.ParseFloat(app.Config.NonceDiff, 64)
+	if err != nil {
+		haltDiff = 20
+	}
+	resumeDiff := parseInt(app.Config.Nonce.ResumeDiff, 0)
+	minDuration := time.Duration(parseInt(app.Config.Nonce.MinStateDuration, 10000)) * time.Millisecond
+
+	shrinking := n.hasPrev && gap < n.prevGap
+	n.prevGap, n.hasPrev = gap, true
+
+	if float64(gap) > haltDiff {
+		n.over++
+	} else {
+		n.over = 0
+	}
+
+	if gap <= int64(resumeDiff) {
+		n.under++
+	} else {
+		n.under = 0
+	}
+
+	if time.Since(n.lastChange) < minDuration {
+		return nonceKeep
+	}
+
+	if engineOn && !shrinking && n.over >= parseInt(app.Config.Nonce.HaltSamples, 3) {
+		return nonceHalt
+	}
+
+	if !engineOn && n.under >= parseInt(app.Config.Nonce.ResumeSamples, 3) {
+		return nonceResume
+	}
+
+	return nonceKeep
+}
+
+// changed records that the engine status has just changed.
+func (n *nonceMonitor) changed() {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	n.lastChange = time.Now()
+	n.over, n.under = 0, 0
+}
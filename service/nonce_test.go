@@ -0,0 +1,64 @@
+package service
+
+import (
+	"pickup/app"
+	"testing"
+)
+
+func TestNonceMonitorObserve(t *testing.T) {
+	app.Config.NonceDiff = "20"
+	app.Config.Nonce.HaltSamples = "3"
+	app.Config.Nonce.ResumeDiff = "0"
+	app.Config.Nonce.ResumeSamples = "2"
+	app.Config.Nonce.MinStateDuration = "0"
+
+	tests := []struct {
+		name     string
+		gaps     []int64
+		engineOn bool
+		want     nonceDecision
+	}{
+		{"gap within diff", []int64{5, 10, 20}, true, nonceKeep},
+		{"burst shorter than halt samples", []int64{30, 40}, true, nonceKeep},
+		{"burst broken by a small gap", []int64{30, 40, 10, 50}, true, nonceKeep},
+		{"gap over diff for halt samples", []int64{30, 40, 50}, true, nonceHalt},
+		{"gap over diff but shrinking", []int64{50, 40, 30}, true, nonceKeep},
+		{"gap over diff and steady", []int64{30, 30, 30}, true, nonceHalt},
+		{"halted engine is not halted again", []int64{30, 40, 50}, false, nonceKeep},
+		{"matched for resume samples", []int64{0, 0}, false, nonceResume},
+		{"matched once", []int64{30, 0}, false, nonceKeep},
+		{"running engine is not resumed", []int64{0, 0, 0}, true, nonceKeep},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			n := newNonceMonitor()
+
+			got := nonceKeep
+			for _, gap := range tt.gaps {
+				got = n.observe(gap, tt.engineOn)
+			}
+
+			if got != tt.want {
+				t.Errorf("observe(%v) = %v, want %v", tt.gaps, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNonceMonitorMinStateDuration(t *testing.T) {
+	app.Config.NonceDiff = "20"
+	app.Config.Nonce.HaltSamples = "1"
+	app.Config.Nonce.ResumeSamples = "1"
+	app.Config.Nonce.MinStateDuration = "60000"
+
+	n := newNonceMonitor()
+	if got := n.observe(30, true); got != nonceHalt {
+		t.Fatalf("observe before any change = %v, want %v", got, nonceHalt)
+	}
+
+	n.changed()
+	if got := n.observe(0, false); got != nonceKeep {
+		t.Errorf("observe within min state duration = %v, want %v", got, nonceKeep)
+	}
+}
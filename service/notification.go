@@ -0,0 +1,120 @@
+package service
+
+import (
+	"encoding/json"
+	"pickup/models/notification"
+	"pickup/models/position"
+	"time"
+
+	"github.com/Undercurrent-Technologies/kprime-utilities/commons/logs"
+	"github.com/Undercurrent-Technologies/kprime-utilities/models/order"
+	"github.com/Undercurrent-Technologies/kprime-utilities/models/trade"
+	"github.com/Undercurrent-Technologies/kprime-utilities/models/user"
+	"github.com/Undercurrent-Technologies/kprime-utilities/types"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	kafkago "github.com/segmentio/kafka-go"
+)
+
+// orderEvents are the event types of the order statuses notified to users.
+var orderEvents = map[types.OrderStatus]string{
+	types.PARTIAL_FILLED: notification.OrderPartiallyFilled,
+	types.FILLED:         notification.OrderFilled,
+	types.CANCELLED:      notification.OrderCancelled,
+}
+
+// notify queues a user event, queued events are published once the message
+// is persisted.
+func (m *ManagerService) notify(userID primitive.ObjectID, t string, data interface{}) {
+	m.events = append(m.events, notification.Event{
+		Version:   notification.Version,
+		ID:        primitive.NewObjectID().Hex(),
+		Type:      t,
+		UserID:    userID.Hex(),
+		Data:      data,
+		CreatedAt: time.Now(),
+	})
+}
+
+// notifyOrder queues an event when the order status or filled amount changed.
+func (m *ManagerService) notifyOrder(old, o *order.Order) {
+	t, ok := orderEvents[o.Status]
+	if !ok {
+		return
+	}
+
+	if old != nil && old.Status == o.Status && old.GetFilledAmount().Equal(o.GetFilledAmount()) {
+		return
+	}
+
+	m.notify(o.UserID, t, notification.Order{
+		OrderID:        o.ID.Hex(),
+		InstrumentName: o.OrderCode(),
+		Side:           o.Side.String(),
+		Status:         o.Status.String(),
+		Price:          o.Price,
+		Amount:         o.Amount,
+		FilledAmount:   o.FilledAmount,
+	})
+}
+
+func (m *ManagerService) notifyTrade(t string, tr *trade.Trade, us *trade.User) {
+	m.notify(us.UserID, t, notification.Trade{
+		TradeID:        tr.ID.Hex(),
+		OrderID:        us.OrderID.Hex(),
+		InstrumentName: tr.OrderCode(),
+		Side:           us.Side.String(),
+		Role:           feeRole(tr, us),
+		Price:          tr.Price,
+		Amount:         tr.Amount,
+		Fee:            feeAmount(us).String(),
+	})
+}
+
+func (m *ManagerService) notifyBalance(userID primitive.ObjectID, c *user.Collaterals) {
+	for _, bal := range c.Balances {
+		if bal.Currency == collateralCurrency {
+			m.notify(userID, notification.BalanceChanged, notification.Balance{Currency: bal.Currency, Amount: bal.Amount})
+			return
+		}
+	}
+}
+
+func (m *ManagerService) notifyPosition(p *position.Position) {
+	if p == nil {
+		return
+	}
+
+	m.notify(p.UserID, notification.PositionChanged, notification.Position{
+		InstrumentName: p.InstrumentName,
+		Amount:         p.Amount,
+		AveragePrice:   p.AveragePrice,
+		RealizedPnl:    p.RealizedPnl,
+	})
+}
+
+// publishNotifications publishes the queued events of the nonce, keyed by
+// user id so that the events of a user stay ordered.
+func (m *ManagerService) publishNotifications(nonce int64) {
+	if len(m.events) == 0 {
+		return
+	}
+
+	msgs := []kafkago.Message{}
+	for _, e := range m.events {
+		e.Nonce = nonce
+
+		v, err := json.Marshal(e)
+		if err != nil {
+			logs.Log.Error().Err(err).Msg("Failed to encode user event")
+			continue
+		}
+
+		msgs = append(msgs, kafkago.Message{Topic: notification.Topic.String(), Key: []byte(e.UserID), Value: v})
+	}
+	m.events = nil
+
+	if err := m.kafkaConn.Publish(msgs...); err != nil {
+		logs.Log.Error().Err(err).Int64("nonce", nonce).Msg("Failed to publish user events")
+	}
+}
@@ -0,0 +1,157 @@
+package service
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"pickup/app"
+	"pickup/datasources/kafka"
+	"pickup/datasources/mongo"
+	"pickup/models/status"
+	"strings"
+	"time"
+
+	"github.com/Undercurrent-Technologies/kprime-utilities/commons/logs"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	kafkago "github.com/segmentio/kafka-go"
+)
+
+var webhookClient = &http.Client{Timeout: 5 * time.Second}
+
+// webhookPayload is compatible with both Slack ("text") and Discord ("content") webhooks.
+type webhookPayload struct {
+	Text    string `json:"text"`
+	Content string `json:"content"`
+}
+
+// StatusNotifier records engine status changes and broadcasts them to kafka,
+// the stream and the configured webhooks.
+type StatusNotifier struct {
+	kafkaConn *kafka.Kafka
+	history   *mongo.Repository[status.Change]
+	stream    *StreamService
+}
+
+func NewStatusNotifier(k *kafka.Kafka, st *StreamService) StatusNotifier {
+	return StatusNotifier{
+		kafkaConn: k,
+		history:   mongo.NewRepository[status.Change](mongo.Database, status.Collection),
+		stream:    st,
+	}
+}
+
+func (sn *StatusNotifier) Notify(c *status.Change) {
+	if err := sn.history.Create(c); err != nil {
+		logs.Log.Error().Err(err).Msg("Failed to save engine status change")
+	}
+
+	v, err := json.Marshal(c)
+	if err != nil {
+		logs.Log.Error().Err(err).Msg("Failed to encode engine status change")
+		return
+	}
+
+	go sn.publish(c, v)
+
+	sn.stream.PublishStatus(c)
+
+	text := fmt.Sprintf(
+		"Matching engine is %s (was %s), reason: %s, engine nonce: %d, mongo nonce: %d",
+		c.NewStatus, c.OldStatus, c.Reason, c.EngineNonce, c.MongoNonce,
+	)
+	alert(text)
+}
+
+// publish publishes the change to the topic with the webhook retries and
+// records its delivery on the history entry.
+func (sn *StatusNotifier) publish(c *status.Change, v []byte) {
+	msg := kafkago.Message{Topic: status.Topic.String(), Key: []byte("engine"), Value: v}
+	published := retry(func() bool {
+		if err := sn.kafkaConn.Publish(msg); err != nil {
+			logs.Log.Warn().Err(err).Msg("Failed to publish engine status change")
+			return false
+		}
+
+		return true
+	})
+	if !published {
+		logs.Log.Error().Any("id", c.ID).Msg("Engine status change not delivered")
+		return
+	}
+
+	update := bson.M{"$set": bson.M{"publishedAt": time.Now()}}
+	if _, err := sn.history.Update(bson.M{"_id": c.ID}, update); err != nil {
+		logs.Log.Error().Err(err).Any("id", c.ID).Msg("Failed to record engine status change delivery")
+	}
+}
+
+func (sn *StatusNotifier) FindHistory(page, limit int64) ([]status.Change, error) {
+	opts := options.Find().
+		SetSort(bson.M{"createdAt": -1}).
+		SetSkip((page - 1) * limit).
+		SetLimit(limit)
+
+	return sn.history.Find(bson.M{}, opts)
+}
+
+// alert posts the text to the configured webhooks.
+func alert(text string) {
+	for _, url := range webhookURLs() {
+		go sendWebhook(url, webhookPayload{Text: text, Content: text})
+	}
+}
+
+func webhookURLs() []string {
+	urls := []string{}
+	for _, url := range strings.Split(app.Config.Webhook.URLs, ",") {
+		if url = strings.TrimSpace(url); url != "" {
+			urls = append(urls, url)
+		}
+	}
+
+	return urls
+}
+
+// sendWebhook posts the payload, retrying with exponential backoff.
+func sendWebhook(url string, p webhookPayload) {
+	body, err := json.Marshal(p)
+	if err != nil {
+		return
+	}
+
+	sent := retry(func() bool {
+		res, err := webhookClient.Post(url, "application/json", bytes.NewReader(body))
+		if err != nil {
+			return false
+		}
+		res.Body.Close()
+
+		return res.StatusCode >= 200 && res.StatusCode < 300
+	})
+	if !sent {
+		logs.Log.Error().Str("url", url).Msg("Failed to send webhook")
+	}
+}
+
+// retry calls fn until it succeeds, up to STATUS_WEBHOOK_RETRIES more times with
+// exponential backoff, and returns whether it succeeded.
+func retry(fn func() bool) bool {
+	retries := parseInt(app.Config.Webhook.Retries, 3)
+	backoff := time.Second
+
+	for attempt := 0; attempt <= retries; attempt++ {
+		if attempt > 0 {
+			time.Sleep(backoff)
+			backoff *= 2
+		}
+
+		if fn() {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,97 @@
+package service
+
+import (
+	"pickup/datasources/collector"
+	"pickup/datasources/mongo"
+	"pickup/models/override"
+
+	"github.com/Undercurrent-Technologies/kprime-utilities/commons/logs"
+	"github.com/Undercurrent-Technologies/kprime-utilities/interfaces"
+	"github.com/Undercurrent-Technologies/kprime-utilities/models/system"
+	"github.com/Undercurrent-Technologies/kprime-utilities/repository/mongodb"
+	"github.com/Undercurrent-Technologies/kprime-utilities/types"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// OverrideService reads and writes the operator override of the system
+// through the same repository, the system repository only gives its id.
+type OverrideService struct {
+	system    interfaces.Repository[system.System]
+	overrides *mongo.Repository[override.Record]
+}
+
+func NewOverrideService(r *mongodb.Repositories) OverrideService {
+	return OverrideService{
+		system:    r.System,
+		overrides: mongo.NewRepository[override.Record](mongo.Database, override.Collection),
+	}
+}
+
+// Find returns the active override of the system, clearing it once expired.
+func (ov *OverrideService) Find(s *system.System) *override.Override {
+	res := ov.overrides.FindOne(bson.M{"_id": s.ID})
+	if res == nil || res.Override == nil {
+		setOverrideMetric("")
+		return nil
+	}
+
+	if res.Override.Expired() {
+		logs.Log.Info().Any("override", res.Override).Msg("Matching engine override expired")
+		ov.clear(s)
+		return nil
+	}
+
+	setOverrideMetric(res.Override.Status)
+
+	return res.Override
+}
+
+func (ov *OverrideService) Set(o *override.Override) error {
+	s := findSystem(ov.system)
+	if s == nil {
+		return ErrSystemNotFound
+	}
+
+	filter := bson.M{"_id": s.ID}
+	update := bson.M{"$set": bson.M{"override": o}}
+	if _, err := ov.overrides.FindAndModify(filter, update); err != nil {
+		return err
+	}
+
+	logs.Log.Info().Any("override", o).Msg("Matching engine override set")
+	setOverrideMetric(o.Status)
+
+	return nil
+}
+
+func (ov *OverrideService) Clear() error {
+	s := findSystem(ov.system)
+	if s == nil {
+		return ErrSystemNotFound
+	}
+
+	return ov.clear(s)
+}
+
+func (ov *OverrideService) clear(s *system.System) error {
+	filter := bson.M{"_id": s.ID}
+	update := bson.M{"$unset": bson.M{"override": ""}}
+	if _, err := ov.overrides.Update(filter, update); err != nil {
+		return err
+	}
+
+	setOverrideMetric("")
+
+	return nil
+}
+
+func setOverrideMetric(status string) {
+	for _, st := range []string{types.ON.String(), types.OFF.String()} {
+		v := float64(0)
+		if st == status {
+			v = 1
+		}
+
+		collector.EngineOverrideGauge.WithLabelValues(st).Set(v)
+	}
+}
@@ -0,0 +1,296 @@
+package service
+
+import (
+	"errors"
+	"pickup/app"
+	"pickup/datasources/mongo"
+	"pickup/models/fee"
+	"pickup/models/position"
+	"time"
+
+	"github.com/Undercurrent-Technologies/kprime-utilities/commons/logs"
+	"github.com/Undercurrent-Technologies/kprime-utilities/models/trade"
+	"github.com/Undercurrent-Technologies/kprime-utilities/types"
+	"github.com/shopspring/decimal"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	mongodriver "go.mongodb.org/mongo-driver/mongo"
+)
+
+var ErrPositionConflict = errors.New("PositionConflict")
+
+// PositionService keeps the entry price and profit of the contract positions.
+// Positions are updated with a compare-and-swap on their version, like the
+// collaterals, since trades and settlements update them concurrently.
+type PositionService struct {
+	positions *mongo.Repository[position.Position]
+	retries   int
+}
+
+func NewPositionService() PositionService {
+	return PositionService{
+		positions: mongo.NewRepository[position.Position](mongo.Database, position.Collection),
+		retries:   parseInt(app.Config.Collateral.Retries, 5),
+	}
+}
+
+// Apply adds the side of the user in the trade to the position once and
+// returns the updated position.
+func (ps *PositionService) Apply(t *trade.Trade, us *trade.User) (*position.Position, error) {
+	amount := t.GetAmount()
+	if us.Side == types.SELL {
+		amount = amount.Neg()
+	}
+
+	return ps.apply(us.UserID, t.OrderCode(), amount, t.GetPrice(), feeAmount(us), appliedKey(t.ID, feeRole(t, us)))
+}
+
+// Reverse takes the side of the user in the failed trade out of the position
+// once. The average price and realized PnL before a trade which closed or
+// flipped the position are lost, the trade price is used as average price
+// instead.
+func (ps *PositionService) Reverse(t *trade.Trade, us *trade.User) (*position.Position, error) {
+	amount := t.GetAmount()
+	if us.Side == types.SELL {
+		amount = amount.Neg()
+	}
+
+	key := appliedKey(t.ID, fee.Reversals[feeRole(t, us)])
+	return ps.update(us.UserID, t.OrderCode(), func(p *position.Position) *position.Position {
+		if p == nil || contains(p.AppliedTrades, key) {
+			return nil
+		}
+
+		fees, _ := decimal.NewFromString(p.Fees)
+		before, approximated := newPositionState(p).reverse(amount, t.GetPrice())
+		if approximated {
+			logs.Log.Warn().Any("userId", us.UserID).Str("instrument", p.InstrumentName).Msg("Reversed position average price is approximated")
+		}
+
+		next := before.position(p)
+		next.Fees = fees.Sub(feeAmount(us)).String()
+		next.AppliedTrades = withAppliedTrade(p.AppliedTrades, key)
+
+		return next
+	})
+}
+
+// close closes what remains of the position at the price, a closed position
+// is left unchanged.
+func (ps *PositionService) close(userID primitive.ObjectID, instrument string, price decimal.Decimal) (*position.Position, error) {
+	return ps.update(userID, instrument, func(p *position.Position) *position.Position {
+		if p == nil {
+			return nil
+		}
+
+		s := newPositionState(p)
+		if s.qty.IsZero() {
+			return nil
+		}
+
+		return s.apply(s.qty.Neg(), price).position(p)
+	})
+}
+
+// Find returns the positions of the user by instrument name.
+func (ps *PositionService) Find(userID primitive.ObjectID) (map[string]position.Position, error) {
+	positions, err := ps.positions.Find(bson.M{"userId": userID})
+	if err != nil {
+		return nil, err
+	}
+
+	res := map[string]position.Position{}
+	for _, p := range positions {
+		res[p.InstrumentName] = p
+	}
+
+	return res, nil
+}
+
+// apply opens, increases, reduces or flips the position by the signed amount
+// at the given price, unless the key of the trade side was already applied.
+func (ps *PositionService) apply(userID primitive.ObjectID, instrument string, amount, price, fee decimal.Decimal, key string) (*position.Position, error) {
+	return ps.update(userID, instrument, func(p *position.Position) *position.Position {
+		if p == nil {
+			p = &position.Position{UserID: userID, InstrumentName: instrument, Fees: "0"}
+		} else if contains(p.AppliedTrades, key) {
+			return nil
+		}
+
+		fees, _ := decimal.NewFromString(p.Fees)
+		next := newPositionState(p).apply(amount, price).position(p)
+		next.Fees = fees.Add(fee).String()
+		next.AppliedTrades = withAppliedTrade(p.AppliedTrades, key)
+
+		return next
+	})
+}
+
+// update applies fn to the current position, nil when there is none yet,
+// reading it again and retrying when it was changed in between. Nothing is
+// written when fn returns nil. Returns the resulting position.
+func (ps *PositionService) update(userID primitive.ObjectID, instrument string, fn func(p *position.Position) *position.Position) (*position.Position, error) {
+	filter := bson.M{"userId": userID, "instrumentName": instrument}
+	for attempt := 0; attempt <= ps.retries; attempt++ {
+		p := ps.positions.FindOne(filter)
+		next := fn(p)
+		if next == nil {
+			return p, nil
+		}
+		next.UpdatedAt = time.Now()
+
+		if p == nil {
+			next.ID = primitive.NewObjectID()
+			next.Version = 1
+			err := ps.positions.Create(next)
+			if err == nil {
+				return next, nil
+			}
+
+			// Created in between
+			if !mongodriver.IsDuplicateKeyError(err) {
+				return nil, err
+			}
+		} else {
+			// Positions created before versions have none
+			cas := bson.M{"_id": p.ID, "version": p.Version}
+			if p.Version == 0 {
+				cas["version"] = bson.M{"$in": bson.A{0, nil}}
+			}
+
+			next.ID = p.ID
+			next.Version = p.Version + 1
+			ok, err := ps.positions.Update(cas, bson.M{"$set": next})
+			if err != nil {
+				return nil, err
+			}
+
+			if ok {
+				return next, nil
+			}
+		}
+
+		logs.Log.Warn().Any("userId", userID).Str("instrument", instrument).Int("attempt", attempt+1).Msg("Position conflict")
+	}
+
+	return nil, ErrPositionConflict
+}
+
+// positionState is the signed amount, average price and realized PnL of a
+// position.
+type positionState struct {
+	qty         decimal.Decimal
+	avg         decimal.Decimal
+	pnl         decimal.Decimal
+	unknownCost bool
+}
+
+func newPositionState(p *position.Position) positionState {
+	s := positionState{unknownCost: p.UnknownCost}
+	s.qty, _ = decimal.NewFromString(p.Amount)
+	s.avg, _ = decimal.NewFromString(p.AveragePrice)
+	s.pnl, _ = decimal.NewFromString(p.RealizedPnl)
+
+	return s
+}
+
+// position returns a copy of the position holding the state.
+func (s positionState) position(p *position.Position) *position.Position {
+	next := *p
+	next.Amount = s.qty.String()
+	next.AveragePrice = s.avg.String()
+	next.CostBasis = s.qty.Abs().Mul(s.avg).String()
+	next.RealizedPnl = s.pnl.String()
+	next.UnknownCost = s.unknownCost
+
+	return &next
+}
+
+// apply adds the signed amount traded at the price. Reducing realizes the
+// price difference against the average price of the closed amount, except
+// for positions of unknown cost which become known once closed or flipped.
+func (s positionState) apply(amount, price decimal.Decimal) positionState {
+	qty := s.qty.Add(amount)
+
+	switch {
+	case s.unknownCost && (qty.IsZero() || qty.Sign() == s.qty.Sign()):
+		if qty.IsZero() {
+			return positionState{pnl: s.pnl}
+		}
+		s.qty = qty
+	case s.unknownCost:
+		// Flipped, the remaining amount is opened at the trade price
+		return positionState{qty: qty, avg: price, pnl: s.pnl}
+	case s.qty.IsZero() || s.qty.Sign() == amount.Sign():
+		total := s.qty.Abs().Add(amount.Abs())
+		if !total.IsZero() {
+			s.avg = s.qty.Abs().Mul(s.avg).Add(amount.Abs().Mul(price)).Div(total)
+		}
+		s.qty = qty
+	default:
+		closed := decimal.Min(s.qty.Abs(), amount.Abs())
+		s.pnl = s.pnl.Add(closed.Mul(price.Sub(s.avg)).Mul(decimal.NewFromInt(int64(s.qty.Sign()))))
+
+		if qty.IsZero() {
+			s.avg = decimal.Zero
+		} else if qty.Sign() == amount.Sign() {
+			// Flipped, the remaining amount is opened at the trade price
+			s.avg = price
+		}
+		s.qty = qty
+	}
+
+	return s
+}
+
+// reverse takes the signed amount traded at the price out of the position
+// and reports whether the average price had to be approximated. The average
+// price and realized PnL before a trade which closed or flipped the position
+// are lost, the trade price is used as average price instead.
+func (s positionState) reverse(amount, price decimal.Decimal) (positionState, bool) {
+	before := s.qty.Sub(amount)
+
+	switch {
+	case s.unknownCost:
+		s.qty = before
+	case before.IsZero():
+		// Opened by the trade
+		s.avg = decimal.Zero
+		s.qty = before
+	case before.Sign() == amount.Sign():
+		// Increased by the trade
+		s.avg = s.qty.Abs().Mul(s.avg).Sub(amount.Abs().Mul(price)).Div(before.Abs())
+		s.qty = before
+	case !s.qty.IsZero() && s.qty.Sign() == before.Sign():
+		// Reduced by the trade
+		s.pnl = s.pnl.Sub(amount.Abs().Mul(price.Sub(s.avg)).Mul(decimal.NewFromInt(int64(before.Sign()))))
+		s.qty = before
+	default:
+		// Closed or flipped by the trade, the realized PnL is kept
+		s.avg = price
+		s.qty = before
+		return s, true
+	}
+
+	return s, false
+}
+
+// appliedKey identifies the application of a trade side, the role is the
+// fee ledger role of the side or of its reversal.
+func appliedKey(tradeID primitive.ObjectID, role string) string {
+	return tradeID.Hex() + ":" + role
+}
+
+// withAppliedTrade adds the key to the latest applied trade sides.
+func withAppliedTrade(keys []string, key string) []string {
+	if key == "" {
+		return keys
+	}
+
+	keys = append(append([]string{}, keys...), key)
+	if len(keys) > position.AppliedTradesLimit {
+		keys = keys[len(keys)-position.AppliedTradesLimit:]
+	}
+
+	return keys
+}
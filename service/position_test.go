@@ -0,0 +1,93 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/shopspring/decimal"
+)
+
+func d(v string) decimal.Decimal {
+	return decimal.RequireFromString(v)
+}
+
+type fill struct {
+	amount string
+	price  string
+}
+
+func TestPositionStateApply(t *testing.T) {
+	tests := []struct {
+		name    string
+		start   positionState
+		fills   []fill
+		qty     string
+		avg     string
+		pnl     string
+		unknown bool
+	}{
+		{"open long", positionState{}, []fill{{"2", "10"}}, "2", "10", "0", false},
+		{"open short", positionState{}, []fill{{"-2", "10"}}, "-2", "10", "0", false},
+		{"increase long", positionState{}, []fill{{"1", "10"}, {"3", "20"}}, "4", "17.5", "0", false},
+		{"reduce long at profit", positionState{}, []fill{{"4", "10"}, {"-1", "15"}}, "3", "10", "5", false},
+		{"reduce short at profit", positionState{}, []fill{{"-4", "10"}, {"1", "6"}}, "-3", "10", "4", false},
+		{"close long at loss", positionState{}, []fill{{"2", "10"}, {"-2", "7"}}, "0", "0", "-6", false},
+		{"flip long to short", positionState{}, []fill{{"2", "10"}, {"-5", "12"}}, "-3", "12", "4", false},
+		{"reduce unknown cost", positionState{qty: d("5"), unknownCost: true}, []fill{{"-2", "12"}}, "3", "0", "0", true},
+		{"increase unknown cost", positionState{qty: d("5"), unknownCost: true}, []fill{{"2", "12"}}, "7", "0", "0", true},
+		{"close unknown cost", positionState{qty: d("5"), unknownCost: true}, []fill{{"-5", "12"}}, "0", "0", "0", false},
+		{"flip unknown cost", positionState{qty: d("5"), unknownCost: true}, []fill{{"-7", "12"}}, "-2", "12", "0", false},
+		{"reopen after unknown cost", positionState{qty: d("5"), unknownCost: true}, []fill{{"-5", "12"}, {"1", "9"}, {"-1", "10"}}, "0", "0", "1", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := tt.start
+			for _, f := range tt.fills {
+				s = s.apply(d(f.amount), d(f.price))
+			}
+
+			if !s.qty.Equal(d(tt.qty)) || !s.avg.Equal(d(tt.avg)) || !s.pnl.Equal(d(tt.pnl)) || s.unknownCost != tt.unknown {
+				t.Errorf("apply() = %s @ %s, pnl %s, unknown %v, want %s @ %s, pnl %s, unknown %v",
+					s.qty, s.avg, s.pnl, s.unknownCost, tt.qty, tt.avg, tt.pnl, tt.unknown)
+			}
+		})
+	}
+}
+
+func TestPositionStateReverse(t *testing.T) {
+	tests := []struct {
+		name         string
+		fills        []fill
+		approximated bool
+	}{
+		{"opening trade", []fill{{"2", "10"}}, false},
+		{"increasing trade", []fill{{"1", "10"}, {"3", "20"}}, false},
+		{"reducing trade", []fill{{"4", "10"}, {"-1", "15"}}, false},
+		{"reducing short trade", []fill{{"-4", "10"}, {"1", "6"}}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before := positionState{}
+			for _, f := range tt.fills[:len(tt.fills)-1] {
+				before = before.apply(d(f.amount), d(f.price))
+			}
+
+			last := tt.fills[len(tt.fills)-1]
+			got, approximated := before.apply(d(last.amount), d(last.price)).reverse(d(last.amount), d(last.price))
+			if approximated != tt.approximated {
+				t.Fatalf("reverse() approximated = %v, want %v", approximated, tt.approximated)
+			}
+
+			if !got.qty.Equal(before.qty) || !got.avg.Equal(before.avg) || !got.pnl.Equal(before.pnl) {
+				t.Errorf("reverse() = %s @ %s, pnl %s, want %s @ %s, pnl %s",
+					got.qty, got.avg, got.pnl, before.qty, before.avg, before.pnl)
+			}
+		})
+	}
+
+	closed := positionState{qty: d("2"), avg: d("10")}.apply(d("-5"), d("12"))
+	if got, approximated := closed.reverse(d("-5"), d("12")); !approximated || !got.qty.Equal(d("2")) || !got.avg.Equal(d("12")) {
+		t.Errorf("reverse() of a flipping trade = %s @ %s, approximated %v, want 2 @ 12, approximated true", got.qty, got.avg, approximated)
+	}
+}
@@ -0,0 +1,160 @@
+package service
+
+import (
+	"errors"
+	"pickup/app"
+	"pickup/datasources/kafka"
+	"pickup/datasources/mongo"
+	"pickup/models/archive"
+	"pickup/models/offset"
+
+	"github.com/Undercurrent-Technologies/kprime-utilities/commons/logs"
+	"github.com/Undercurrent-Technologies/kprime-utilities/interfaces"
+	"github.com/Undercurrent-Technologies/kprime-utilities/models/activity"
+	"github.com/Undercurrent-Technologies/kprime-utilities/repository/mongodb"
+	"github.com/Undercurrent-Technologies/kprime-utilities/types"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var ErrInconsistentState = errors.New("InconsistentState")
+
+// Recovery modes applied when committed offsets do not match the activities
+const (
+	RecoveryWarn = "warn"
+	RecoverySeek = "seek"
+	RecoveryFail = "fail"
+)
+
+// Consistency of a topic partition
+const (
+	OffsetConsistent = "CONSISTENT"
+	OffsetBehind     = "BEHIND"
+	OffsetAhead      = "AHEAD"
+)
+
+// Topics are created with a single partition, activities do not record it.
+const recoveryPartition = 0
+
+type TopicRecovery struct {
+	Topic               string `json:"topic"`
+	Partition           int    `json:"partition"`
+	LastProcessedOffset int64  `json:"lastProcessedOffset"`
+	CommittedOffset     int64  `json:"committedOffset"`
+	Status              string `json:"status"`
+}
+
+type RecoveryReport struct {
+	LastNonce int64           `json:"lastNonce"`
+	Mode      string          `json:"mode"`
+	Topics    []TopicRecovery `json:"topics"`
+}
+
+// Recover determines the last applied nonce and the last processed kafka
+// offsets and validates them against the offsets committed by the consumer
+// group.
+//
+// The committed offset of a partition is expected to follow the last
+// processed offset, i.e. the highest of the recorded processed offset and of
+// the offsets of the saved and archived activities. When it is behind,
+// already applied messages are consumed again and skipped. When it is ahead,
+// messages have been committed without being processed, which is either
+// reported, fixed by seeking back or refused depending on the recovery mode.
+func Recover(k *kafka.Kafka, r *mongodb.Repositories) (*RecoveryReport, error) {
+	report := &RecoveryReport{Mode: app.Config.Recovery.Mode}
+
+	nonce, err := lastNonce(r.Activity)
+	if err != nil {
+		return nil, err
+	}
+	report.LastNonce = nonce
+
+	inconsistent := false
+	for _, t := range []types.Topic{types.ENGINE, types.CANCELLED_ORDER} {
+		tr, err := recoverTopic(k, r, t.String())
+		if err != nil {
+			return nil, err
+		}
+
+		if tr.Status == OffsetAhead && report.Mode == RecoverySeek {
+			if err := k.Seek(tr.Topic, tr.Partition, tr.LastProcessedOffset+1); err != nil {
+				return nil, err
+			}
+			tr.CommittedOffset = tr.LastProcessedOffset + 1
+			tr.Status = OffsetConsistent
+		}
+
+		inconsistent = inconsistent || tr.Status == OffsetAhead
+		report.Topics = append(report.Topics, *tr)
+	}
+
+	logs.Log.Info().Any("report", report).Msg("Recovery report")
+
+	if inconsistent && report.Mode == RecoveryFail {
+		return report, ErrInconsistentState
+	}
+
+	return report, nil
+}
+
+// lastNonce returns the highest applied nonce, including archived activities.
+func lastNonce(activities interfaces.Repository[activity.Activity]) (int64, error) {
+	pipeline := []bson.M{{"$sort": bson.M{"nonce": -1}}, {"$limit": 1}}
+	acts, err := activities.Aggregate(pipeline)
+	if err != nil {
+		return 0, err
+	}
+
+	if len(acts) > 0 {
+		return acts[0].Nonce, nil
+	}
+
+	index := mongo.NewRepository[archive.Index](mongo.Database, archive.IndexCollection)
+	if idx := index.FindOne(bson.M{}, options.FindOne().SetSort(bson.M{"nonce": -1})); idx != nil {
+		return idx.Nonce, nil
+	}
+
+	return 0, nil
+}
+
+func recoverTopic(k *kafka.Kafka, r *mongodb.Repositories, topic string) (*TopicRecovery, error) {
+	tr := &TopicRecovery{Topic: topic, Partition: recoveryPartition, LastProcessedOffset: -1}
+
+	// Resynced activities have no kafka offset
+	match := bson.M{"kafkaOffset": bson.M{"$gte": 0}, "topic": topic}
+	pipeline := []bson.M{{"$match": match}, {"$sort": bson.M{"kafkaOffset": -1}}, {"$limit": 1}}
+	acts, err := r.Activity.Aggregate(pipeline)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(acts) > 0 {
+		tr.LastProcessedOffset = acts[0].KafkaOffset
+	}
+
+	opts := options.FindOne().SetSort(bson.M{"kafkaOffset": -1})
+	index := mongo.NewRepository[archive.Index](mongo.Database, archive.IndexCollection)
+	if idx := index.FindOne(match, opts); idx != nil && idx.KafkaOffset > tr.LastProcessedOffset {
+		tr.LastProcessedOffset = idx.KafkaOffset
+	}
+
+	offsets := mongo.NewRepository[offset.Processed](mongo.Database, offset.Collection)
+	if p := offsets.FindOne(bson.M{"topic": topic, "partition": tr.Partition}); p != nil && p.Offset > tr.LastProcessedOffset {
+		tr.LastProcessedOffset = p.Offset
+	}
+
+	if tr.CommittedOffset, err = k.CommittedOffset(topic, tr.Partition); err != nil {
+		return nil, err
+	}
+
+	switch {
+	case tr.LastProcessedOffset < 0 || tr.CommittedOffset == tr.LastProcessedOffset+1:
+		tr.Status = OffsetConsistent
+	case tr.CommittedOffset <= tr.LastProcessedOffset:
+		tr.Status = OffsetBehind
+	default:
+		tr.Status = OffsetAhead
+	}
+
+	return tr, nil
+}
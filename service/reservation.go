@@ -0,0 +1,159 @@
+package service
+
+import (
+	"context"
+	"pickup/app"
+	"pickup/datasources/mongo"
+	"pickup/models/reservation"
+	"time"
+
+	"github.com/Undercurrent-Technologies/kprime-utilities/commons/logs"
+	"github.com/Undercurrent-Technologies/kprime-utilities/models/order"
+	"github.com/Undercurrent-Technologies/kprime-utilities/types"
+	"github.com/shopspring/decimal"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// ReservationService keeps the collateral reserved by open orders. Buy orders
+// reserve the premium of their remaining amount and the highest taker fee on
+// it. Sell orders reserve nothing as they receive the premium, the margin of
+// sell orders opening or extending a short position is NOT covered, so the
+// available balance of such users is overstated by that margin.
+type ReservationService struct {
+	orders   *mongo.Repository[reservation.Order]
+	balances *mongo.Repository[reservation.Balance]
+	feeRate  decimal.Decimal
+}
+
+func NewReservationService() ReservationService {
+	feeRate, err := decimal.NewFromString(app.Config.Reservation.FeeRate)
+	if err != nil || feeRate.IsNegative() {
+		feeRate = decimal.Zero
+	}
+
+	return ReservationService{
+		orders:   mongo.NewRepository[reservation.Order](mongo.Database, reservation.OrderCollection),
+		balances: mongo.NewRepository[reservation.Balance](mongo.Database, reservation.BalanceCollection),
+		feeRate:  feeRate,
+	}
+}
+
+// Apply updates the reservations of the orders to their current state and
+// refreshes the reserved balance of every affected user.
+func (rs *ReservationService) Apply(orders []*order.Order) {
+	rs.apply(orders, false)
+}
+
+// Release releases the reservations of the cancelled orders whatever their
+// reported status.
+func (rs *ReservationService) Release(orders []*order.Order) {
+	rs.apply(orders, true)
+}
+
+func (rs *ReservationService) apply(orders []*order.Order, release bool) {
+	users := map[primitive.ObjectID]bool{}
+	for _, o := range orders {
+		changed, err := rs.reserve(o, release)
+		if err != nil {
+			logs.Log.Error().Err(err).Any("orderId", o.ID).Msg("Failed to update order reservation")
+			continue
+		}
+
+		if changed {
+			users[o.UserID] = true
+		}
+	}
+
+	for id := range users {
+		if err := rs.refresh(id, collateralCurrency); err != nil {
+			logs.Log.Error().Err(err).Any("userId", id).Msg("Failed to refresh reserved balance")
+		}
+	}
+}
+
+// FindBalance returns the reserved balance of the user, zero when nothing is reserved.
+func (rs *ReservationService) FindBalance(userID primitive.ObjectID, currency string) decimal.Decimal {
+	b := rs.balances.FindOne(bson.M{"userId": userID, "currency": currency})
+	if b == nil {
+		return decimal.Zero
+	}
+
+	d, _ := decimal.NewFromString(b.Reserved)
+	return d
+}
+
+// reserve sets the reservation of the order and reports whether it changed.
+// Orders which are no longer open or released release their reservation.
+func (rs *ReservationService) reserve(o *order.Order, release bool) (bool, error) {
+	amount := decimal.Zero
+	if !release && (o.Status == types.OPEN || o.Status == types.PARTIAL_FILLED) && o.Side == types.BUY {
+		amount = o.GetAmount().Sub(o.GetFilledAmount()).Mul(o.GetPrice())
+		if amount.IsNegative() {
+			amount = decimal.Zero
+		}
+		amount = amount.Add(amount.Mul(rs.feeRate))
+	}
+
+	filter := bson.M{"_id": o.ID}
+	current := rs.orders.FindOne(filter)
+	if current == nil && amount.IsZero() {
+		return false, nil
+	}
+
+	if current != nil {
+		d, _ := decimal.NewFromString(current.Amount)
+		if d.Equal(amount) && current.Status == o.Status {
+			return false, nil
+		}
+	}
+
+	if amount.IsZero() {
+		_, err := rs.orders.Collection().DeleteOne(context.Background(), filter)
+		return err == nil, err
+	}
+
+	update := bson.M{"$set": reservation.Order{
+		ID:        o.ID,
+		UserID:    o.UserID,
+		Currency:  collateralCurrency,
+		Amount:    amount.String(),
+		Status:    o.Status,
+		UpdatedAt: time.Now(),
+	}}
+	if _, err := rs.orders.FindAndModify(filter, update); err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// refresh recomputes the reserved balance from the order reservations, so
+// that it never drifts from them.
+func (rs *ReservationService) refresh(userID primitive.ObjectID, currency string) error {
+	pipeline := []bson.M{
+		{"$match": bson.M{"userId": userID, "currency": currency}},
+		{"$group": bson.M{"_id": nil, "reserved": bson.M{"$sum": bson.M{"$toDecimal": "$amount"}}}},
+	}
+
+	res := []struct {
+		Reserved primitive.Decimal128 `bson:"reserved"`
+	}{}
+	if err := rs.orders.Aggregate(pipeline, &res); err != nil {
+		return err
+	}
+
+	reserved := decimal.Zero
+	if len(res) > 0 {
+		reserved, _ = decimal.NewFromString(res[0].Reserved.String())
+	}
+
+	filter := bson.M{"userId": userID, "currency": currency}
+	update := bson.M{
+		"$set":         bson.M{"reserved": reserved.String(), "updatedAt": time.Now()},
+		"$setOnInsert": bson.M{"_id": primitive.NewObjectID()},
+	}
+	_, err := rs.balances.FindAndModify(filter, update)
+
+	return err
+}
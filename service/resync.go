@@ -0,0 +1,112 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"pickup/app"
+	"pickup/datasources/engine"
+	"sort"
+	"strconv"
+	"sync"
+
+	"github.com/Undercurrent-Technologies/kprime-utilities/commons/logs"
+
+	kafkago "github.com/segmentio/kafka-go"
+)
+
+// ActivitySource provides the activities processed by the matching engine.
+type ActivitySource interface {
+	FetchActivities(ctx context.Context, from, to int64) ([]engine.Activity, error)
+}
+
+// ResyncService catches mongo up with the matching engine by applying the
+// missing activities through the same path as kafka messages.
+type ResyncService struct {
+	source  ActivitySource
+	manager *ManagerService
+	running bool
+	mutex   *sync.Mutex
+}
+
+func NewResyncService(c *engine.Client, m *ManagerService) *ResyncService {
+	var source ActivitySource = c
+	if app.Config.Resync.StubFile != "" {
+		source = engine.NewFileSource(app.Config.Resync.StubFile)
+	}
+
+	return &ResyncService{source: source, manager: m, mutex: &sync.Mutex{}}
+}
+
+func (rs *ResyncService) Enabled() bool {
+	enabled, _ := strconv.ParseBool(app.Config.Resync.Enabled)
+	return enabled
+}
+
+// Start runs a resync in the background unless one is already running and
+// calls done once it succeeded.
+func (rs *ResyncService) Start(from, to int64, done func()) {
+	rs.mutex.Lock()
+	defer rs.mutex.Unlock()
+
+	if rs.running {
+		return
+	}
+	rs.running = true
+
+	go func() {
+		defer func() {
+			rs.mutex.Lock()
+			rs.running = false
+			rs.mutex.Unlock()
+		}()
+
+		if err := rs.Run(from, to); err != nil {
+			logs.Log.Error().Err(err).Int64("from", from).Int64("to", to).Msg("Failed to resync from matching engine")
+			return
+		}
+
+		done()
+	}()
+}
+
+// Run applies the engine activities with nonce between from and to in batches.
+func (rs *ResyncService) Run(from, to int64) error {
+	logs.Log.Info().Int64("from", from).Int64("to", to).Msg("Resync from matching engine started")
+
+	batch := int64(parseInt(app.Config.Resync.BatchSize, 500))
+	for start := from; start <= to; start += batch {
+		end := start + batch - 1
+		if end > to {
+			end = to
+		}
+
+		acts, err := rs.source.FetchActivities(context.Background(), start, end)
+		if err != nil {
+			return err
+		}
+
+		sort.Slice(acts, func(i, j int) bool { return acts[i].Nonce < acts[j].Nonce })
+
+		next := start
+		for _, a := range acts {
+			if a.Nonce != next {
+				return fmt.Errorf("missing engine activity of nonce %d", next)
+			}
+
+			msg := kafkago.Message{Topic: a.Topic, Value: a.Payload, Offset: -1}
+			if err := rs.manager.Apply(msg); err != nil {
+				return fmt.Errorf("failed to apply nonce %d: %w", a.Nonce, err)
+			}
+
+			next++
+		}
+
+		if next != end+1 {
+			return fmt.Errorf("missing engine activity of nonce %d", next)
+		}
+	}
+
+	logs.Log.Info().Int64("from", from).Int64("to", to).Msg("Resync from matching engine finished")
+
+	return nil
+}
@@ -0,0 +1,330 @@
+package service
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"pickup/app"
+	"pickup/datasources/mongo"
+	"pickup/models/archive"
+	"pickup/models/chain"
+	"sort"
+	"time"
+
+	"github.com/Undercurrent-Technologies/kprime-utilities/commons/logs"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// archivedActivity is the part of an archived activity document needed to index it.
+type archivedActivity struct {
+	ID          primitive.ObjectID `bson:"_id"`
+	Nonce       int64              `bson:"nonce"`
+	KafkaOffset int64              `bson:"kafkaOffset"`
+	Topic       string             `bson:"topic"`
+	Hash        string             `bson:"hash"`
+	OutOfOrder  bool               `bson:"outOfOrder"`
+	CreatedAt   time.Time          `bson:"createdAt"`
+}
+
+// RetentionService moves old activities out of the activity collection into
+// gzip JSON lines files or an archive collection. Documents are archived as
+// canonical extended JSON, so that restored activities are byte for byte
+// identical and still verify against the hash chain.
+type RetentionService struct {
+	activities *mongo.Repository[bson.Raw]
+	archives   *mongo.Repository[bson.Raw]
+	index      *mongo.Repository[archive.Index]
+}
+
+func NewRetentionService() RetentionService {
+	return RetentionService{
+		activities: mongo.NewRepository[bson.Raw](mongo.Database, chain.Collection),
+		archives:   mongo.NewRepository[bson.Raw](mongo.Database, archive.ArchiveCollection),
+		index:      mongo.NewRepository[archive.Index](mongo.Database, archive.IndexCollection),
+	}
+}
+
+// Archive moves the activities older than ArchiveAfterDays to the archive in
+// batches ordered by nonce. Restored activities are kept for the same period
+// after their restoration.
+func (rs *RetentionService) Archive() (int, error) {
+	cutoff := time.Now().AddDate(0, 0, -parseInt(app.Config.Archive.AfterDays, 30))
+	filter := bson.M{
+		"createdAt": bson.M{"$lt": cutoff},
+		"$or": []bson.M{
+			{"restoredAt": bson.M{"$exists": false}},
+			{"restoredAt": bson.M{"$lt": cutoff}},
+		},
+	}
+
+	batch := int64(parseInt(app.Config.Archive.BatchSize, 1000))
+	opts := options.Find().SetSort(bson.M{"nonce": 1}).SetLimit(batch)
+
+	total := 0
+	for {
+		docs, err := rs.activities.Find(filter, opts)
+		if err != nil || len(docs) == 0 {
+			return total, err
+		}
+
+		if err := rs.archiveBatch(docs); err != nil {
+			return total, err
+		}
+
+		total += len(docs)
+		if int64(len(docs)) < batch {
+			break
+		}
+	}
+
+	logs.Log.Info().Int("total", total).Msg("Activities archived")
+
+	return total, nil
+}
+
+func (rs *RetentionService) archiveBatch(docs []bson.Raw) error {
+	metas := make([]archivedActivity, len(docs))
+	for i, doc := range docs {
+		if err := bson.Unmarshal(doc, &metas[i]); err != nil {
+			return err
+		}
+	}
+
+	location, err := rs.store(docs, metas[0].Nonce, metas[len(metas)-1].Nonce)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	ids := make([]primitive.ObjectID, len(metas))
+	for i, m := range metas {
+		topic := m.Topic
+		if topic == "" {
+			topic = legacyTopic(docs[i])
+		}
+
+		idx := archive.Index{
+			ID:          m.ID,
+			Nonce:       m.Nonce,
+			KafkaOffset: m.KafkaOffset,
+			Topic:       topic,
+			Hash:        m.Hash,
+			OutOfOrder:  m.OutOfOrder,
+			Location:    location,
+			CreatedAt:   m.CreatedAt,
+			ArchivedAt:  now,
+		}
+
+		opts := options.Replace().SetUpsert(true)
+		if _, err := rs.index.Collection().ReplaceOne(context.Background(), bson.M{"_id": m.ID}, idx, opts); err != nil {
+			return err
+		}
+
+		ids[i] = m.ID
+	}
+
+	_, err = rs.activities.Collection().DeleteMany(context.Background(), bson.M{"_id": bson.M{"$in": ids}})
+
+	return err
+}
+
+// store writes the documents to the configured archive and returns their location.
+func (rs *RetentionService) store(docs []bson.Raw, from, to int64) (string, error) {
+	if app.Config.Archive.Mode == archive.ModeCollection {
+		opts := options.Replace().SetUpsert(true)
+		for _, doc := range docs {
+			filter := bson.M{"_id": doc.Lookup("_id")}
+			if _, err := rs.archives.Collection().ReplaceOne(context.Background(), filter, doc, opts); err != nil {
+				return "", err
+			}
+		}
+
+		return archive.ModeCollection, nil
+	}
+
+	if err := os.MkdirAll(app.Config.Archive.Dir, 0o755); err != nil {
+		return "", err
+	}
+
+	name := fmt.Sprintf("activities-%d-%d-%d.jsonl.gz", from, to, time.Now().Unix())
+	path := filepath.Join(app.Config.Archive.Dir, name)
+	if err := writeArchive(path+".tmp", docs); err != nil {
+		return "", err
+	}
+
+	return name, os.Rename(path+".tmp", path)
+}
+
+func writeArchive(path string, docs []bson.Raw) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	gz := gzip.NewWriter(f)
+	for _, doc := range docs {
+		line, err := bson.MarshalExtJSON(doc, true, false)
+		if err != nil {
+			return err
+		}
+
+		if _, err := gz.Write(append(line, '\n')); err != nil {
+			return err
+		}
+	}
+
+	if err := gz.Close(); err != nil {
+		return err
+	}
+
+	return f.Sync()
+}
+
+// Restore puts the archived activities with nonce between from and to back
+// into the activity collection.
+func (rs *RetentionService) Restore(from, to int64) (int, error) {
+	filter := bson.M{"nonce": bson.M{"$gte": from, "$lte": to}}
+	indexes, err := rs.index.Find(filter)
+	if err != nil {
+		return 0, err
+	}
+
+	locations := map[string]bool{}
+	for _, idx := range indexes {
+		locations[idx.Location] = true
+	}
+
+	total := 0
+	now := primitive.NewDateTimeFromTime(time.Now())
+	for location := range locations {
+		docs, err := rs.load(location, from, to)
+		if err != nil {
+			return total, err
+		}
+
+		opts := options.Replace().SetUpsert(true)
+		for _, doc := range docs {
+			// Keep the stored values untouched for the hash chain
+			restored := bson.D{}
+			elems, err := doc.Elements()
+			if err != nil {
+				return total, err
+			}
+			for _, e := range elems {
+				if e.Key() != "restoredAt" {
+					restored = append(restored, bson.E{Key: e.Key(), Value: e.Value()})
+				}
+			}
+			restored = append(restored, bson.E{Key: "restoredAt", Value: now})
+
+			filter := bson.M{"_id": doc.Lookup("_id")}
+			if _, err := rs.activities.Collection().ReplaceOne(context.Background(), filter, restored, opts); err != nil {
+				return total, err
+			}
+
+			total++
+		}
+	}
+
+	logs.Log.Info().Int64("from", from).Int64("to", to).Int("total", total).Msg("Activities restored")
+
+	return total, nil
+}
+
+// load reads the archived documents with nonce between from and to.
+func (rs *RetentionService) load(location string, from, to int64) ([]bson.Raw, error) {
+	inRange := func(doc bson.Raw) bool {
+		n, ok := doc.Lookup("nonce").AsInt64OK()
+		return ok && n >= from && n <= to
+	}
+
+	if location == archive.ModeCollection {
+		return rs.archives.Find(bson.M{"nonce": bson.M{"$gte": from, "$lte": to}})
+	}
+
+	f, err := os.Open(filepath.Join(app.Config.Archive.Dir, filepath.Base(location)))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, err
+	}
+	defer gz.Close()
+
+	docs := []bson.Raw{}
+	r := bufio.NewReader(gz)
+	for {
+		line, err := r.ReadBytes('\n')
+		if len(line) > 0 {
+			var doc bson.Raw
+			if e := bson.UnmarshalExtJSON(line, true, &doc); e != nil {
+				return nil, e
+			}
+
+			if inRange(doc) {
+				docs = append(docs, doc)
+			}
+		}
+
+		if errors.Is(err, io.EOF) {
+			return docs, nil
+		}
+
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// Archived calls fn with the archived activities from the nonce in nonce
+// order, one archive at a time.
+func (rs *RetentionService) Archived(from int64, fn func(doc bson.Raw) error) error {
+	pipeline := []bson.M{
+		{"$match": bson.M{"nonce": bson.M{"$gte": from}}},
+		{"$group": bson.M{"_id": "$location", "first": bson.M{"$min": "$nonce"}, "last": bson.M{"$max": "$nonce"}}},
+		{"$sort": bson.M{"first": 1}},
+	}
+	locations := []struct {
+		Location string `bson:"_id"`
+		First    int64  `bson:"first"`
+		Last     int64  `bson:"last"`
+	}{}
+	if err := rs.index.Aggregate(pipeline, &locations); err != nil {
+		return err
+	}
+
+	for _, l := range locations {
+		docs, err := rs.load(l.Location, from, l.Last)
+		if err != nil {
+			return err
+		}
+
+		sort.Slice(docs, func(i, j int) bool {
+			return docs[i].Lookup("nonce").AsInt64() < docs[j].Lookup("nonce").AsInt64()
+		})
+
+		for _, doc := range docs {
+			if err := fn(doc); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// FindIndex returns the index entry of an archived activity.
+func (rs *RetentionService) FindIndex(nonce int64) *archive.Index {
+	return rs.index.FindOne(bson.M{"nonce": nonce})
+}
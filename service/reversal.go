@@ -0,0 +1,114 @@
+package service
+
+import (
+	"pickup/models/fee"
+	"pickup/models/notification"
+	"pickup/models/reversal"
+
+	"github.com/Undercurrent-Technologies/kprime-utilities/commons/logs"
+	"github.com/Undercurrent-Technologies/kprime-utilities/models/trade"
+	"github.com/Undercurrent-Technologies/kprime-utilities/models/user"
+	"github.com/Undercurrent-Technologies/kprime-utilities/types"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// opposite is the side which reverses a trade side.
+var opposite = map[types.Side]types.Side{types.BUY: types.SELL, types.SELL: types.BUY}
+
+// reverseTrade posts the compensating collateral, position and fee changes of
+// the sides of a failed trade which were applied as successful. The fee
+// ledger tells which sides were applied, so each side is reversed once.
+// Trades applied before the fee ledger existed have no ledger entries and
+// can never be reversed.
+func (m *ManagerService) reverseTrade(t *trade.Trade) []reversal.Reversal {
+	fees, err := m.fee.Reversible(t.ID)
+	if err != nil {
+		logs.Log.Error().Err(err).Any("tradeId", t.ID).Msg("Failed to find reversible trade")
+		return nil
+	}
+
+	res := []reversal.Reversal{}
+	for i := range fees {
+		f := &fees[i]
+
+		us := t.Maker
+		if f.Role == fee.Taker {
+			us = t.Taker
+		}
+
+		if us == nil || us.UserID != f.UserID {
+			logs.Log.Error().Any("tradeId", t.ID).Str("role", f.Role).Msg("Failed trade side does not match the applied side")
+			continue
+		}
+
+		if err := m.reverseSide(t, us, f); err != nil {
+			logs.Log.Error().Err(err).Any("tradeId", t.ID).Str("role", f.Role).Msg("Failed to reverse trade")
+			continue
+		}
+
+		res = append(res, reversal.Reversal{
+			TradeID:        t.ID,
+			UserID:         us.UserID,
+			Role:           f.Role,
+			Side:           us.Side,
+			InstrumentName: f.InstrumentName,
+			Amount:         t.Amount,
+			Price:          t.Price,
+			Fee:            f.Amount,
+		})
+	}
+
+	if len(res) > 0 {
+		logs.Log.Info().Any("tradeId", t.ID).Int("sides", len(res)).Msg("Failed trade reversed")
+	}
+
+	return res
+}
+
+// reverseSide applies the opposite side with the fee refunded, using the
+// instrument and fee as they were applied. The collaterals and the position
+// record the reversal with the update and the ledger entry is written last,
+// so a reversal which failed halfway only completes the missing steps.
+func (m *ManagerService) reverseSide(t *trade.Trade, us *trade.User, f *fee.Fee) error {
+	amount := f.GetAmount()
+	premium := t.GetAmount().Mul(t.GetPrice())
+
+	var collaterals *user.Collaterals
+	applied, err := m.collateral.Apply(us.UserID, appliedKey(t.ID, fee.Reversals[f.Role]), func(c *user.Collaterals) bool {
+		applyTrade(c, f.InstrumentName, opposite[us.Side], t.GetAmount(), premium, amount.Neg())
+		collaterals = c
+		return true
+	})
+	if err != nil {
+		return err
+	}
+
+	if applied {
+		m.notifyTrade(notification.TradeReversed, t, us)
+		m.notifyBalance(us.UserID, collaterals)
+	}
+
+	pos, err := m.position.Reverse(t, us)
+	if err != nil {
+		logs.Log.Error().Err(err).Any("userId", us.UserID).Msg("Failed to reverse user position")
+		return err
+	}
+	m.notifyPosition(pos)
+
+	return m.fee.Reverse(f)
+}
+
+// withReversals adds the reversals to the activity data.
+func withReversals(data interface{}, r []reversal.Reversal) (interface{}, error) {
+	raw, err := bson.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+
+	d := bson.D{}
+	if err := bson.Unmarshal(raw, &d); err != nil {
+		return nil, err
+	}
+
+	return append(d, bson.E{Key: "reversals", Value: r}), nil
+}
@@ -0,0 +1,237 @@
+package service
+
+import (
+	"context"
+	"pickup/app"
+	"pickup/datasources/mongo"
+	"pickup/datasources/price"
+	"pickup/models/instrument"
+	"pickup/models/settlement"
+	"time"
+
+	"github.com/Undercurrent-Technologies/kprime-utilities/commons/logs"
+	"github.com/Undercurrent-Technologies/kprime-utilities/models/user"
+	"github.com/shopspring/decimal"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// SettlementService cash-settles the contracts of expired options.
+type SettlementService struct {
+	source      price.Source
+	collateral  CollateralService
+	position    PositionService
+	settlements *mongo.Repository[settlement.Settlement]
+}
+
+func NewSettlementService() SettlementService {
+	var source price.Source
+	if app.Config.Settlement.PriceFile != "" {
+		source = price.NewFileSource(app.Config.Settlement.PriceFile)
+	} else {
+		timeout := time.Duration(parseInt(app.Config.Settlement.Timeout, 2000)) * time.Millisecond
+		source = price.NewHTTPSource(app.Config.Settlement.PriceURL, timeout)
+	}
+
+	return SettlementService{
+		source:      source,
+		collateral:  NewCollateralService(),
+		position:    NewPositionService(),
+		settlements: mongo.NewRepository[settlement.Settlement](mongo.Database, settlement.Collection),
+	}
+}
+
+// Settle settles every contract of the expired instruments held by users and
+// returns the number of settled contracts. Instruments without a settlement
+// price yet are retried on the next run.
+func (ss *SettlementService) Settle() (int, error) {
+	total, err := ss.resume()
+	if err != nil {
+		return total, err
+	}
+
+	names, err := ss.collateral.FindInstruments()
+	if err != nil {
+		return total, err
+	}
+
+	now := time.Now()
+	for _, name := range names {
+		i, err := instrument.Parse(name)
+		if err != nil {
+			logs.Log.Warn().Str("instrument", name).Msg("Unable to parse instrument")
+			continue
+		}
+
+		if !i.Expired(now) {
+			continue
+		}
+
+		p, err := ss.source.SettlementPrice(context.Background(), i.Underlying, i.Expiry)
+		if err != nil {
+			logs.Log.Error().Err(err).Str("instrument", name).Msg("Failed to fetch settlement price")
+			continue
+		}
+
+		n, err := ss.settleInstrument(i, p)
+		total += n
+		if err != nil {
+			return total, err
+		}
+
+		logs.Log.Info().Str("instrument", name).Str("price", p.String()).Int("contracts", n).Msg("Instrument settled")
+	}
+
+	return total, nil
+}
+
+func (ss *SettlementService) settleInstrument(i *instrument.Instrument, p decimal.Decimal) (int, error) {
+	users, err := ss.collateral.FindHolders(i.Name)
+	if err != nil {
+		return 0, err
+	}
+
+	payoff := i.Payoff(p)
+	n := 0
+	for _, id := range users {
+		settled, err := ss.settleUser(id, i, p, payoff)
+		if err != nil {
+			logs.Log.Error().Err(err).Any("userId", id).Str("instrument", i.Name).Msg("Failed to settle contract")
+			continue
+		}
+
+		if settled {
+			n++
+		}
+	}
+
+	return n, nil
+}
+
+// settleUser records the pending ledger entry of the contract, one per user,
+// instrument and sequence, then settles it. A settlement interrupted by a
+// crash stays pending and is finalized by the next run. A contract added again
+// by a late trade after being settled gets the next sequence. Returns whether
+// this run settled the contract.
+func (ss *SettlementService) settleUser(id primitive.ObjectID, i *instrument.Instrument, p, payoff decimal.Decimal) (bool, error) {
+	filter := bson.M{"userId": id, "instrumentName": i.Name}
+	s := ss.settlements.FindOne(filter, options.FindOne().SetSort(bson.M{"sequence": -1}))
+	if s != nil && s.Status == settlement.StatusPending {
+		return true, ss.finalize(s)
+	}
+
+	amount, err := ss.collateral.FindContract(id, i.Name)
+	if err != nil || amount == nil {
+		return false, err
+	}
+
+	sequence := 0
+	if s != nil {
+		sequence = s.Sequence + 1
+	}
+
+	filter["sequence"] = sequence
+	update := bson.M{"$setOnInsert": settlement.Settlement{
+		ID:              primitive.NewObjectID(),
+		UserID:          id,
+		InstrumentName:  i.Name,
+		Sequence:        sequence,
+		Currency:        collateralCurrency,
+		Amount:          amount.String(),
+		SettlementPrice: p.String(),
+		Payoff:          payoff.String(),
+		Value:           amount.Mul(payoff).String(),
+		Status:          settlement.StatusPending,
+		ExpiredAt:       i.Expiry,
+		CreatedAt:       time.Now(),
+	}}
+	if s, err = ss.settlements.FindAndModify(filter, update); err != nil {
+		return false, err
+	}
+
+	// Settled by a concurrent run
+	if s.Status != settlement.StatusPending {
+		return false, nil
+	}
+
+	return true, ss.finalize(s)
+}
+
+// resume finalizes the settlements left pending by an interrupted run and
+// returns their number.
+func (ss *SettlementService) resume() (int, error) {
+	pending, err := ss.settlements.Find(bson.M{"status": settlement.StatusPending})
+	if err != nil {
+		return 0, err
+	}
+
+	n := 0
+	for i := range pending {
+		if err := ss.finalize(&pending[i]); err != nil {
+			logs.Log.Error().Err(err).Any("userId", pending[i].UserID).Str("instrument", pending[i].InstrumentName).Msg("Failed to settle contract")
+			continue
+		}
+		n++
+	}
+
+	return n, nil
+}
+
+// finalize removes the contract from the user collaterals and credits its
+// value, closes the position at the payoff and marks the ledger entry as
+// settled. Every step can run again: a removed contract is not credited again
+// and a closed position is left unchanged.
+func (ss *SettlementService) finalize(s *settlement.Settlement) error {
+	payoff, _ := decimal.NewFromString(s.Payoff)
+
+	var amount *decimal.Decimal
+	err := ss.collateral.Update(s.UserID, func(c *user.Collaterals) bool {
+		amount = nil
+		contracts := []*user.Contract{}
+		for _, con := range c.Contracts {
+			if con.InstrumentName == s.InstrumentName && amount == nil {
+				a := con.GetAmount()
+				amount = &a
+				continue
+			}
+
+			contracts = append(contracts, con)
+		}
+
+		// Already removed and credited
+		if amount == nil {
+			return false
+		}
+
+		c.Contracts = contracts
+		value := amount.Mul(payoff)
+		for _, bal := range c.Balances {
+			if bal.Currency == s.Currency {
+				bal.Amount = bal.GetAmount().Add(value).String()
+				return true
+			}
+		}
+
+		c.Balances = append(c.Balances, &user.Balance{Currency: s.Currency, Amount: value.String()})
+
+		return true
+	})
+	if err != nil {
+		return err
+	}
+
+	if _, err := ss.position.close(s.UserID, s.InstrumentName, payoff); err != nil {
+		return err
+	}
+
+	set := bson.M{"status": settlement.StatusSettled, "settledAt": time.Now()}
+	if amount != nil {
+		set["amount"] = amount.String()
+		set["value"] = amount.Mul(payoff).String()
+	}
+
+	_, err = ss.settlements.Update(bson.M{"_id": s.ID, "status": settlement.StatusPending}, bson.M{"$set": set})
+
+	return err
+}
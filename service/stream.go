@@ -0,0 +1,431 @@
+package service
+
+import (
+	"encoding/json"
+	"pickup/app"
+	"pickup/datasources/mongo"
+	"pickup/models/chain"
+	"pickup/models/status"
+	"pickup/models/stream"
+	"sync"
+
+	"github.com/Undercurrent-Technologies/kprime-utilities/commons/logs"
+	model "github.com/Undercurrent-Technologies/kprime-utilities/models/kafka"
+	"github.com/Undercurrent-Technologies/kprime-utilities/models/order"
+	"github.com/Undercurrent-Technologies/kprime-utilities/models/trade"
+	"github.com/Undercurrent-Technologies/kprime-utilities/types"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const replayBatchSize = 500
+
+// StreamFilter selects the events of a subscription, empty fields match all.
+// Admin subscriptions stream the events as saved, the others the view of the
+// events of their user.
+type StreamFilter struct {
+	UserID         string
+	InstrumentName string
+	Topic          string
+	Admin          bool
+}
+
+func (f *StreamFilter) match(e *stream.Event) bool {
+	if f.Topic != "" && f.Topic != e.Topic {
+		return false
+	}
+
+	// Status changes concern every user and instrument
+	if e.Type == stream.StatusEvent {
+		return true
+	}
+
+	return (f.UserID == "" || contains(e.Users, f.UserID)) &&
+		(f.InstrumentName == "" || contains(e.Instruments, f.InstrumentName))
+}
+
+// view returns the event as streamed to the subscription, nil when it is not
+// streamed to it.
+func (f *StreamFilter) view(e *stream.Event) *stream.Event {
+	if !f.match(e) {
+		return nil
+	}
+
+	if f.Admin || e.Type == stream.StatusEvent {
+		return e
+	}
+
+	v, ok := e.Views[f.UserID]
+	if !ok {
+		return nil
+	}
+
+	return &stream.Event{Type: e.Type, Topic: e.Topic, Nonce: e.Nonce, Data: v, Users: e.Users, Instruments: e.Instruments}
+}
+
+// Subscription receives the events matching its filter. Done is closed when
+// the subscriber is too slow to keep up and its events are dropped. While
+// the subscriber replays saved activities, live events are kept aside until
+// Live is called.
+type Subscription struct {
+	Events chan *stream.Event
+	Done   chan struct{}
+	filter StreamFilter
+	once   sync.Once
+
+	mutex     sync.Mutex
+	replaying bool
+	pending   []*stream.Event
+	limit     int
+}
+
+func (s *Subscription) drop() {
+	s.once.Do(func() { close(s.Done) })
+}
+
+// deliver never blocks, the subscription is dropped when its buffer is full.
+func (s *Subscription) deliver(e *stream.Event) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.replaying {
+		if len(s.pending) >= s.limit {
+			s.drop()
+			return
+		}
+		s.pending = append(s.pending, e)
+		return
+	}
+
+	select {
+	case s.Events <- e:
+	default:
+		s.drop()
+	}
+}
+
+// Live ends the replay and returns the events published during it, the
+// following events are sent to Events.
+func (s *Subscription) Live() []*stream.Event {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	pending := s.pending
+	s.replaying, s.pending = false, nil
+
+	return pending
+}
+
+// StreamService fans the saved activities, trades and status changes out to
+// the subscriptions.
+type StreamService struct {
+	subscriptions map[*Subscription]bool
+	activities    *mongo.Repository[stream.Activity]
+	retention     RetentionService
+	buffer        int
+	replayBuffer  int
+	mutex         *sync.RWMutex
+}
+
+func NewStreamService() *StreamService {
+	return &StreamService{
+		subscriptions: map[*Subscription]bool{},
+		activities:    mongo.NewRepository[stream.Activity](mongo.Database, chain.Collection),
+		retention:     NewRetentionService(),
+		buffer:        parseInt(app.Config.Stream.Buffer, 256),
+		replayBuffer:  parseInt(app.Config.Stream.ReplayBuffer, 10000),
+		mutex:         &sync.RWMutex{},
+	}
+}
+
+// Subscribe registers the subscription, with replay its live events are kept
+// aside until Live is called.
+func (ss *StreamService) Subscribe(f StreamFilter, replay bool) *Subscription {
+	s := &Subscription{
+		Events:    make(chan *stream.Event, ss.buffer),
+		Done:      make(chan struct{}),
+		filter:    f,
+		replaying: replay,
+		limit:     ss.replayBuffer,
+	}
+
+	ss.mutex.Lock()
+	ss.subscriptions[s] = true
+	ss.mutex.Unlock()
+
+	return s
+}
+
+func (ss *StreamService) Unsubscribe(s *Subscription) {
+	ss.mutex.Lock()
+	delete(ss.subscriptions, s)
+	ss.mutex.Unlock()
+}
+
+// Replay sends the archived then the saved activities from the nonce
+// matching the filter and returns the last replayed nonce.
+func (ss *StreamService) Replay(f StreamFilter, from int64, send func(*stream.Event) error) (int64, error) {
+	last := from - 1
+	err := ss.retention.Archived(from, func(doc bson.Raw) error {
+		a := stream.Activity{}
+		if err := bson.Unmarshal(doc, &a); err != nil {
+			return err
+		}
+		last = a.Nonce
+
+		e, err := activityEvent(&a, "")
+		if err != nil {
+			return err
+		}
+
+		if v := f.view(e); v != nil {
+			return send(v)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return last, err
+	}
+
+	for {
+		opts := options.Find().SetSort(bson.M{"nonce": 1}).SetLimit(replayBatchSize)
+		activities, err := ss.activities.Find(bson.M{"nonce": bson.M{"$gt": last}}, opts)
+		if err != nil {
+			return last, err
+		}
+
+		for i := range activities {
+			last = activities[i].Nonce
+
+			e, err := activityEvent(&activities[i], "")
+			if err != nil {
+				return last, err
+			}
+
+			if v := f.view(e); v != nil {
+				if err := send(v); err != nil {
+					return last, err
+				}
+			}
+		}
+
+		if len(activities) < replayBatchSize {
+			return last, nil
+		}
+	}
+}
+
+// PublishActivity streams the saved activity with the trades it saved.
+func (ss *StreamService) PublishActivity(id primitive.ObjectID, topic string, trades []*trade.Trade) {
+	if ss == nil || ss.empty() {
+		return
+	}
+
+	a := ss.activities.FindOne(bson.M{"_id": id})
+	if a == nil {
+		return
+	}
+
+	e, err := activityEvent(a, topic)
+	if err != nil {
+		logs.Log.Error().Err(err).Int64("nonce", a.Nonce).Msg("Failed to stream activity")
+		return
+	}
+	ss.publish(e)
+
+	for _, t := range trades {
+		users := tradeUsers([]string{}, t)
+		views := map[string]interface{}{}
+		for _, u := range users {
+			views[u] = tradeSide(t, u)
+		}
+
+		ss.publish(&stream.Event{
+			Type:        stream.TradeEvent,
+			Topic:       topic,
+			Nonce:       a.Nonce,
+			Data:        t,
+			Users:       users,
+			Instruments: appendNonEmpty([]string{}, t.OrderCode()),
+			Views:       views,
+		})
+	}
+}
+
+func (ss *StreamService) PublishStatus(c *status.Change) {
+	if ss == nil {
+		return
+	}
+
+	ss.publish(&stream.Event{Type: stream.StatusEvent, Topic: status.Topic.String(), Data: c})
+}
+
+// publish never blocks, subscriptions with a full buffer are dropped.
+func (ss *StreamService) publish(e *stream.Event) {
+	ss.mutex.RLock()
+	defer ss.mutex.RUnlock()
+
+	for s := range ss.subscriptions {
+		if v := s.filter.view(e); v != nil {
+			s.deliver(v)
+		}
+	}
+}
+
+func (ss *StreamService) empty() bool {
+	ss.mutex.RLock()
+	defer ss.mutex.RUnlock()
+
+	return len(ss.subscriptions) == 0
+}
+
+// activityQuery is the mass-cancel query of a cancelled order activity.
+type activityQuery struct {
+	UserID         string `json:"userId,omitempty" bson:"userId"`
+	InstrumentName string `json:"instrumentName,omitempty" bson:"instrumentName"`
+	Side           string `json:"side,omitempty" bson:"side"`
+	All            bool   `json:"all,omitempty" bson:"all"`
+}
+
+// activityData holds the parts of the cancelled and rejected order activity
+// data naming users and instruments.
+type activityData struct {
+	Query         *activityQuery `bson:"query"`
+	RejectedOrder *order.Order   `bson:"rejectedOrder"`
+}
+
+// activityEvent builds the event of the activity, the topic is derived from
+// the data for activities stored without it. Data is streamed as relaxed
+// extended JSON, each user of the activity gets the view of its orders and
+// trade sides.
+func activityEvent(a *stream.Activity, topic string) (*stream.Event, error) {
+	d := activityData{}
+	if a.Data.Type == bson.TypeEmbeddedDocument {
+		if err := a.Data.Unmarshal(&d); err != nil {
+			return nil, err
+		}
+	}
+
+	if topic == "" {
+		topic = a.Topic
+	}
+	if topic == "" {
+		topic = types.ENGINE.String()
+		if d.Query != nil {
+			topic = types.CANCELLED_ORDER.String()
+		}
+	}
+
+	orders := []*order.Order{}
+	trades := []*trade.Trade{}
+	users, instruments := []string{}, []string{}
+	switch {
+	case d.Query != nil:
+		users = appendNonEmpty(users, d.Query.UserID)
+		instruments = appendNonEmpty(instruments, d.Query.InstrumentName)
+	case d.RejectedOrder != nil:
+		orders = append(orders, d.RejectedOrder)
+	case a.Data.Type == bson.TypeEmbeddedDocument:
+		m := model.Matches{}
+		if err := a.Data.Unmarshal(&m); err != nil {
+			return nil, err
+		}
+
+		orders = append(orders, m.MakerOrders...)
+		if m.TakerOrder != nil {
+			orders = append(orders, m.TakerOrder)
+		}
+		trades = m.Trades
+	}
+
+	for _, o := range orders {
+		users = appendNonEmpty(users, o.UserID.Hex())
+		instruments = appendNonEmpty(instruments, o.OrderCode())
+	}
+
+	for _, t := range trades {
+		users = tradeUsers(users, t)
+		instruments = appendNonEmpty(instruments, t.OrderCode())
+	}
+
+	views := map[string]interface{}{}
+	for _, u := range users {
+		v := stream.UserActivity{Nonce: a.Nonce, Orders: []*order.Order{}, Trades: []*trade.Trade{}, CreatedAt: a.CreatedAt}
+		for _, o := range orders {
+			if o.UserID.Hex() == u {
+				v.Orders = append(v.Orders, o)
+			}
+		}
+
+		for _, t := range trades {
+			if contains(tradeUsers([]string{}, t), u) {
+				v.Trades = append(v.Trades, tradeSide(t, u))
+			}
+		}
+
+		if d.Query != nil && d.Query.UserID == u {
+			v.Query = d.Query
+		}
+
+		views[u] = v
+	}
+
+	data, err := bson.MarshalExtJSON(a, false, false)
+	if err != nil {
+		return nil, err
+	}
+
+	return &stream.Event{
+		Type:        stream.ActivityEvent,
+		Topic:       topic,
+		Nonce:       a.Nonce,
+		Data:        json.RawMessage(data),
+		Users:       users,
+		Instruments: instruments,
+		Views:       views,
+	}, nil
+}
+
+// tradeUsers adds the users of both sides of the trade.
+func tradeUsers(users []string, t *trade.Trade) []string {
+	for _, us := range []*trade.User{t.Taker, t.Maker} {
+		if us != nil {
+			users = appendNonEmpty(users, us.UserID.Hex())
+		}
+	}
+
+	return users
+}
+
+// tradeSide returns a copy of the trade without the side of the other user.
+func tradeSide(t *trade.Trade, userID string) *trade.Trade {
+	side := *t
+	if side.Taker != nil && side.Taker.UserID.Hex() != userID {
+		side.Taker = nil
+	}
+	if side.Maker != nil && side.Maker.UserID.Hex() != userID {
+		side.Maker = nil
+	}
+
+	return &side
+}
+
+func appendNonEmpty(values []string, v string) []string {
+	if v == "" || contains(values, v) {
+		return values
+	}
+
+	return append(values, v)
+}
+
+func contains(values []string, v string) bool {
+	for _, value := range values {
+		if value == v {
+			return true
+		}
+	}
+
+	return false
+}
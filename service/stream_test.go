@@ -0,0 +1,38 @@
+package service
+
+import (
+	"pickup/models/stream"
+	"testing"
+
+	"github.com/Undercurrent-Technologies/kprime-utilities/models/trade"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestStreamFilterView(t *testing.T) {
+	taker, maker := primitive.NewObjectID(), primitive.NewObjectID()
+	tr := &trade.Trade{Taker: &trade.User{UserID: taker}, Maker: &trade.User{UserID: maker}}
+	e := &stream.Event{
+		Type:  stream.TradeEvent,
+		Data:  tr,
+		Users: []string{taker.Hex(), maker.Hex()},
+		Views: map[string]interface{}{taker.Hex(): tradeSide(tr, taker.Hex()), maker.Hex(): tradeSide(tr, maker.Hex())},
+	}
+
+	if v := (&StreamFilter{Admin: true}).view(e); v != e {
+		t.Errorf("admin view = %+v, want the event", v)
+	}
+
+	v := (&StreamFilter{UserID: taker.Hex()}).view(e)
+	if v == nil {
+		t.Fatal("taker view = nil")
+	}
+
+	side := v.Data.(*trade.Trade)
+	if side.Taker == nil || side.Maker != nil {
+		t.Errorf("taker view = %+v, want the taker side only", side)
+	}
+
+	if v := (&StreamFilter{UserID: primitive.NewObjectID().Hex()}).view(e); v != nil {
+		t.Errorf("other user view = %+v, want nil", v)
+	}
+}
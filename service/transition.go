@@ -0,0 +1,96 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"pickup/datasources/collector"
+
+	"github.com/Undercurrent-Technologies/kprime-utilities/commons/logs"
+	"github.com/Undercurrent-Technologies/kprime-utilities/models/order"
+	"github.com/Undercurrent-Technologies/kprime-utilities/models/trade"
+	"github.com/Undercurrent-Technologies/kprime-utilities/types"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var (
+	ErrIllegalTransition     = errors.New("IllegalTransition")
+	ErrFilledAmountRegressed = errors.New("FilledAmountRegressed")
+)
+
+// orderTransitions are the statuses an order may move to from each status.
+// Filled and cancelled orders are final.
+var orderTransitions = map[types.OrderStatus][]types.OrderStatus{
+	types.OPEN:           {types.OPEN, types.PARTIAL_FILLED, types.FILLED, types.CANCELLED},
+	types.PARTIAL_FILLED: {types.PARTIAL_FILLED, types.FILLED, types.CANCELLED},
+	types.FILLED:         {types.FILLED},
+	types.CANCELLED:      {types.CANCELLED},
+}
+
+// tradeTransitions are the statuses a trade may move to from each status, a
+// successful trade may still fail and is then reversed.
+var tradeTransitions = map[types.TradeStatus][]types.TradeStatus{
+	types.SUCCESS: {types.SUCCESS, types.FAILED},
+	types.FAILED:  {types.FAILED},
+}
+
+// checkOrder verifies the order may move from its stored state, which is nil
+// for new orders, and that its filled amount never decreases. New orders and
+// orders stored with a status missing from the table are not checked.
+func checkOrder(old, o *order.Order) error {
+	if old == nil {
+		return nil
+	}
+
+	next, ok := orderTransitions[old.Status]
+	if !ok {
+		return nil
+	}
+
+	if !allowed(next, o.Status) {
+		return rejectTransition("order", o.ID, old.Status.String(), o.Status.String(), ErrIllegalTransition)
+	}
+
+	if o.GetFilledAmount().LessThan(old.GetFilledAmount()) {
+		return rejectTransition("order", o.ID, old.Status.String(), o.Status.String(), ErrFilledAmountRegressed)
+	}
+
+	return nil
+}
+
+// checkTrade verifies the trade may move from its stored state, which is nil
+// for new trades. New trades and trades stored with a status missing from the
+// table are not checked.
+func checkTrade(old, t *trade.Trade) error {
+	if old == nil {
+		return nil
+	}
+
+	next, ok := tradeTransitions[old.Status]
+	if !ok {
+		return nil
+	}
+
+	if !allowed(next, t.Status) {
+		return rejectTransition("trade", t.ID, old.Status.String(), t.Status.String(), ErrIllegalTransition)
+	}
+
+	return nil
+}
+
+func allowed[T comparable](statuses []T, s T) bool {
+	for _, v := range statuses {
+		if v == s {
+			return true
+		}
+	}
+
+	return false
+}
+
+func rejectTransition(entity string, id primitive.ObjectID, from, to string, err error) error {
+	collector.IllegalTransitionCounter.WithLabelValues(entity, from, to).Inc()
+	logs.Log.Error().Err(err).Any("id", id).Str("from", from).Str("to", to).Msg(fmt.Sprintf("Illegal %s transition rejected", entity))
+	alert(fmt.Sprintf("Illegal %s transition of %s rejected, from: %s, to: %s (%s)", entity, id.Hex(), from, to, err.Error()))
+
+	return err
+}
@@ -0,0 +1,66 @@
+package service
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/Undercurrent-Technologies/kprime-utilities/models/order"
+	"github.com/Undercurrent-Technologies/kprime-utilities/models/trade"
+	"github.com/Undercurrent-Technologies/kprime-utilities/types"
+)
+
+func TestCheckOrder(t *testing.T) {
+	tests := []struct {
+		name    string
+		old     *order.Order
+		status  types.OrderStatus
+		filled  string
+		wantErr error
+	}{
+		{"new order", nil, types.OPEN, "0", nil},
+		{"new order of unknown status", nil, types.OrderStatus("EXPIRED"), "0", nil},
+		{"open to partially filled", &order.Order{Status: types.OPEN, FilledAmount: "0"}, types.PARTIAL_FILLED, "1", nil},
+		{"open to filled", &order.Order{Status: types.OPEN, FilledAmount: "0"}, types.FILLED, "2", nil},
+		{"partially filled to cancelled", &order.Order{Status: types.PARTIAL_FILLED, FilledAmount: "1"}, types.CANCELLED, "1", nil},
+		{"partially filled to open", &order.Order{Status: types.PARTIAL_FILLED, FilledAmount: "1"}, types.OPEN, "1", ErrIllegalTransition},
+		{"filled to cancelled", &order.Order{Status: types.FILLED, FilledAmount: "2"}, types.CANCELLED, "2", ErrIllegalTransition},
+		{"cancelled to open", &order.Order{Status: types.CANCELLED, FilledAmount: "0"}, types.OPEN, "0", ErrIllegalTransition},
+		{"open to unknown status", &order.Order{Status: types.OPEN, FilledAmount: "0"}, types.OrderStatus("EXPIRED"), "0", ErrIllegalTransition},
+		{"unknown stored status", &order.Order{Status: types.OrderStatus("EXPIRED"), FilledAmount: "0"}, types.OPEN, "0", nil},
+		{"filled amount regressed", &order.Order{Status: types.PARTIAL_FILLED, FilledAmount: "2"}, types.PARTIAL_FILLED, "1", ErrFilledAmountRegressed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o := &order.Order{Status: tt.status, FilledAmount: tt.filled}
+			if err := checkOrder(tt.old, o); !errors.Is(err, tt.wantErr) {
+				t.Errorf("checkOrder() = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCheckTrade(t *testing.T) {
+	tests := []struct {
+		name    string
+		old     *trade.Trade
+		status  types.TradeStatus
+		wantErr error
+	}{
+		{"new trade", nil, types.SUCCESS, nil},
+		{"new trade of unknown status", nil, types.TradeStatus("PENDING"), nil},
+		{"success sent again", &trade.Trade{Status: types.SUCCESS}, types.SUCCESS, nil},
+		{"success to failed", &trade.Trade{Status: types.SUCCESS}, types.FAILED, nil},
+		{"failed to success", &trade.Trade{Status: types.FAILED}, types.SUCCESS, ErrIllegalTransition},
+		{"success to unknown status", &trade.Trade{Status: types.SUCCESS}, types.TradeStatus("PENDING"), ErrIllegalTransition},
+		{"unknown stored status", &trade.Trade{Status: types.TradeStatus("PENDING")}, types.SUCCESS, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := checkTrade(tt.old, &trade.Trade{Status: tt.status}); !errors.Is(err, tt.wantErr) {
+				t.Errorf("checkTrade() = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
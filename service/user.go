@@ -0,0 +1,223 @@
+package service
+
+import (
+	"pickup/datasources/mongo"
+	"pickup/models/settlement"
+
+	"github.com/Undercurrent-Technologies/kprime-utilities/interfaces"
+	"github.com/Undercurrent-Technologies/kprime-utilities/models/trade"
+	"github.com/Undercurrent-Technologies/kprime-utilities/models/user"
+	"github.com/Undercurrent-Technologies/kprime-utilities/repository/mongodb"
+	"github.com/Undercurrent-Technologies/kprime-utilities/types"
+	"github.com/shopspring/decimal"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// tradeBatchSize is the number of trades read at once when paging trades
+// matched by instrument name.
+const tradeBatchSize = 500
+
+type Position struct {
+	InstrumentName string `json:"instrumentName"`
+	Amount         string `json:"amount"`
+	Side           string `json:"side"`
+	BoughtAmount   string `json:"boughtAmount"`
+	SoldAmount     string `json:"soldAmount"`
+	TotalTrades    int    `json:"totalTrades"`
+	AveragePrice   string `json:"averagePrice"`
+	CostBasis      string `json:"costBasis"`
+	RealizedPnl    string `json:"realizedPnl"`
+	Fees           string `json:"fees"`
+}
+
+type Balance struct {
+	Currency  string `json:"currency"`
+	Amount    string `json:"amount"`
+	Reserved  string `json:"reserved"`
+	Available string `json:"available"`
+}
+
+type UserService struct {
+	user        interfaces.Repository[user.User]
+	trade       interfaces.Repository[trade.Trade]
+	reservation ReservationService
+	position    PositionService
+	settlements *mongo.Repository[settlement.Settlement]
+}
+
+func NewUserService(r *mongodb.Repositories) UserService {
+	return UserService{
+		user:        r.User,
+		trade:       r.Trade,
+		reservation: NewReservationService(),
+		position:    NewPositionService(),
+		settlements: mongo.NewRepository[settlement.Settlement](mongo.Database, settlement.Collection),
+	}
+}
+
+func (us *UserService) FindCollaterals(id primitive.ObjectID) *user.Collaterals {
+	u := us.user.FindOne(bson.M{"_id": id})
+	if u == nil {
+		return nil
+	}
+
+	return &u.Collaterals
+}
+
+// FindBalances returns the balances of the user together with the amount
+// reserved by open orders and the amount available for new orders.
+func (us *UserService) FindBalances(id primitive.ObjectID) []Balance {
+	u := us.user.FindOne(bson.M{"_id": id})
+	if u == nil {
+		return nil
+	}
+
+	balances := []Balance{}
+	for _, bal := range u.Collaterals.Balances {
+		reserved := us.reservation.FindBalance(id, bal.Currency)
+		balances = append(balances, Balance{
+			Currency:  bal.Currency,
+			Amount:    bal.Amount,
+			Reserved:  reserved.String(),
+			Available: bal.GetAmount().Sub(reserved).String(),
+		})
+	}
+
+	return balances
+}
+
+// FindPositions breaks down every contract held by the user together with
+// the trades that built it.
+func (us *UserService) FindPositions(id primitive.ObjectID) ([]Position, error) {
+	u := us.user.FindOne(bson.M{"_id": id})
+	if u == nil {
+		return nil, nil
+	}
+
+	entries, err := us.position.Find(id)
+	if err != nil {
+		return nil, err
+	}
+
+	positions := []Position{}
+	for _, con := range u.Collaterals.Contracts {
+		bought, sold := decimal.Zero, decimal.Zero
+		total := 0
+
+		trades, err := us.findTrades(id, con.InstrumentName, 0, 0)
+		if err != nil {
+			return nil, err
+		}
+
+		for i := range trades {
+			t := &trades[i]
+			if t.OrderCode() != con.InstrumentName {
+				continue
+			}
+
+			total++
+			for _, s := range userSides(t, id) {
+				if s == types.BUY {
+					bought = bought.Add(t.GetAmount())
+				} else {
+					sold = sold.Add(t.GetAmount())
+				}
+			}
+		}
+
+		side := types.BUY.String()
+		if con.GetAmount().IsNegative() {
+			side = types.SELL.String()
+		}
+
+		entry := entries[con.InstrumentName]
+		positions = append(positions, Position{
+			InstrumentName: con.InstrumentName,
+			Amount:         con.Amount,
+			Side:           side,
+			BoughtAmount:   bought.String(),
+			SoldAmount:     sold.String(),
+			TotalTrades:    total,
+			AveragePrice:   entry.AveragePrice,
+			CostBasis:      entry.CostBasis,
+			RealizedPnl:    entry.RealizedPnl,
+			Fees:           entry.Fees,
+		})
+	}
+
+	return positions, nil
+}
+
+// FindSettlements returns the settlement ledger of the user, latest first.
+func (us *UserService) FindSettlements(id primitive.ObjectID) ([]settlement.Settlement, error) {
+	opts := options.Find().SetSort(bson.M{"createdAt": -1})
+	return us.settlements.Find(bson.M{"userId": id}, opts)
+}
+
+// FindPositionTrades returns the page of successful trades of the user on the
+// given instrument, with one extra trade when another page exists.
+func (us *UserService) FindPositionTrades(id primitive.ObjectID, instrument string, page, limit int64) ([]trade.Trade, error) {
+	skip := (page - 1) * limit
+	res := []trade.Trade{}
+	for offset := int64(0); ; offset += tradeBatchSize {
+		trades, err := us.findTrades(id, instrument, offset, tradeBatchSize)
+		if err != nil {
+			return nil, err
+		}
+
+		for i := range trades {
+			if trades[i].OrderCode() != instrument {
+				continue
+			}
+
+			if skip > 0 {
+				skip--
+				continue
+			}
+
+			res = append(res, trades[i])
+			if int64(len(res)) > limit {
+				return res, nil
+			}
+		}
+
+		if len(trades) < tradeBatchSize {
+			return res, nil
+		}
+	}
+}
+
+// findTrades returns the applied successful trades of the user on the underlying and
+// expiry of the instrument, all of them when limit is zero. The instrument
+// itself is matched by the caller.
+func (us *UserService) findTrades(id primitive.ObjectID, instrument string, skip, limit int64) ([]trade.Trade, error) {
+	match := instrumentFilter(instrument)
+	match["$or"] = []bson.M{{"taker.userId": id}, {"maker.userId": id}}
+	match["status"] = bson.M{"$ne": types.FAILED}
+	// Rejected trades never touched collaterals nor positions
+	match["rejection"] = bson.M{"$exists": false}
+
+	pipeline := []bson.M{{"$match": match}, {"$sort": bson.M{"createdAt": 1, "_id": 1}}}
+	if limit > 0 {
+		pipeline = append(pipeline, bson.M{"$skip": skip}, bson.M{"$limit": limit})
+	}
+
+	return us.trade.Aggregate(pipeline)
+}
+
+// userSides returns the sides taken by the user in the trade, which are
+// both sides when the user traded against itself.
+func userSides(t *trade.Trade, id primitive.ObjectID) []types.Side {
+	sides := []types.Side{}
+	if t.Taker != nil && t.Taker.UserID == id {
+		sides = append(sides, t.Taker.Side)
+	}
+
+	if t.Maker != nil && t.Maker.UserID == id {
+		sides = append(sides, t.Maker.Side)
+	}
+
+	return sides
+}